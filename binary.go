@@ -0,0 +1,248 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// binaryVersion is the version of the binary encoding written by
+// MarshalBinary.
+//
+// the encoding is
+//
+//	version byte
+//	kind    byte, 0 for float64, 1 for int64 and 2 for uint64 values
+//	E       8 byte little endian float64 bits
+//	N       uvarint
+//	Min     8 byte little endian value bits
+//	Max     8 byte little endian value bits
+//	Sum     8 byte little endian float64 bits
+//	NaNs    uvarint
+//	Infs    uvarint
+//	Extra   uvarint ExtraError
+//	count   uvarint number of buffers
+//
+// followed by count buffers each encoded as
+//
+//	level   varint
+//	flags   byte, where bit 0 is set if the buffer is sorted
+//	length  uvarint number of values
+//	data    length 8 byte little endian value bits
+//
+// where the value bits are the float64 bits for floating point values and the
+// two's complement bits for integer values.
+const binaryVersion = 1
+
+// flagSorted is set in the buffer flags if the buffer is sorted.
+const flagSorted = 1 << 0
+
+// errShortBuffer is returned when the binary encoding is truncated.
+var errShortBuffer = errors.New("bad encoding: short buffer")
+
+// errOverflow is returned when a varint in the binary encoding overflows.
+var errOverflow = errors.New("bad encoding: varint overflows")
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (r FinishedRandomOf[T]) MarshalBinary() ([]byte, error) {
+	size := 2 + 4*8 + 5*binary.MaxVarintLen64
+	for _, buf := range r.Buffers {
+		size += 1 + 2*binary.MaxVarintLen64 + 8*len(buf.Data)
+	}
+
+	out := make([]byte, 0, size)
+	out = append(out, binaryVersion, byte(kindOf[T]()))
+	out = binary.LittleEndian.AppendUint64(out, math.Float64bits(r.E))
+	out = binary.AppendUvarint(out, uint64(r.N))
+	out = binary.LittleEndian.AppendUint64(out, valueBits(r.Min))
+	out = binary.LittleEndian.AppendUint64(out, valueBits(r.Max))
+	out = binary.LittleEndian.AppendUint64(out, math.Float64bits(r.Sum))
+	out = binary.AppendUvarint(out, uint64(r.NaNs))
+	out = binary.AppendUvarint(out, uint64(r.Infs))
+	out = binary.AppendUvarint(out, uint64(r.ExtraError))
+	out = binary.AppendUvarint(out, uint64(len(r.Buffers)))
+
+	for _, buf := range r.Buffers {
+		flags := byte(0)
+		if buf.Sorted {
+			flags |= flagSorted
+		}
+
+		out = binary.AppendVarint(out, int64(buf.Level))
+		out = append(out, flags)
+		out = binary.AppendUvarint(out, uint64(len(buf.Data)))
+		for _, v := range buf.Data {
+			out = binary.LittleEndian.AppendUint64(out, valueBits(v))
+		}
+	}
+
+	return out, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It validates that
+// the decoded value could have been produced by a Random or by Merge.
+func (r *FinishedRandomOf[T]) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+
+	version := d.byte()
+	if d.err == nil && version != binaryVersion {
+		return fmt.Errorf("bad encoding: unknown version %d", version)
+	}
+	kind := valueKind(d.byte())
+	if d.err == nil && kind != kindOf[T]() {
+		return fmt.Errorf("bad encoding: kind %d != %d", kind, kindOf[T]())
+	}
+
+	var out FinishedRandomOf[T]
+	out.E = math.Float64frombits(d.uint64())
+	n := d.uvarint()
+	out.Min = valueFromBits[T](d.uint64())
+	out.Max = valueFromBits[T](d.uint64())
+	out.Sum = math.Float64frombits(d.uint64())
+	nans := d.uvarint()
+	infs := d.uvarint()
+	extra := d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	for _, v := range []uint64{n, nans, infs, extra} {
+		if v > math.MaxInt64 {
+			return fmt.Errorf("bad encoding: count %d overflows", v)
+		}
+	}
+	out.N, out.NaNs, out.Infs = int64(n), int64(nans), int64(infs)
+	out.ExtraError = int64(extra)
+
+	// check the epsilon before using it to bound the allocations below.
+	if !validEps(out.E) {
+		return fmt.Errorf("bad encoding: epsilon %v out of range", out.E)
+	}
+	b, s := paramsFromEps(out.E)
+
+	count := d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	if count > uint64(b) {
+		return fmt.Errorf("bad encoding: %d buffers > %d", count, b)
+	}
+
+	out.Buffers = make([]BufferOf[T], 0, count)
+	for i := uint64(0); i < count; i++ {
+		level := d.varint()
+		flags := d.byte()
+		length := d.uvarint()
+		if d.err != nil {
+			return d.err
+		}
+		if level < -1 || level > maxLevel {
+			return fmt.Errorf("bad encoding: buffer %d level %d", i, level)
+		}
+		if flags&^flagSorted != 0 {
+			return fmt.Errorf("bad encoding: buffer %d flags %#x", i, flags)
+		}
+		if length > uint64(s) {
+			return fmt.Errorf("bad encoding: buffer %d length %d > %d",
+				i, length, s)
+		}
+		// every value takes 8 bytes, so don't allocate more than the rest of
+		// the data could hold.
+		if length > uint64(len(d.data)/8) {
+			return errShortBuffer
+		}
+
+		values := make([]T, length)
+		for j := range values {
+			values[j] = valueFromBits[T](d.uint64())
+		}
+		if d.err != nil {
+			return d.err
+		}
+
+		out.Buffers = append(out.Buffers, BufferOf[T]{
+			Data:   values,
+			Level:  int32(level),
+			Sorted: flags&flagSorted != 0,
+		})
+	}
+
+	if len(d.data) > 0 {
+		return fmt.Errorf("bad encoding: %d trailing bytes", len(d.data))
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+
+	*r = out
+	return nil
+}
+
+// decoder consumes values from a byte slice, remembering the first error
+// so that callers only have to check once after a sequence of reads.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 1 {
+		d.err = errShortBuffer
+		return 0
+	}
+	v := d.data[0]
+	d.data = d.data[1:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) < 8 {
+		d.err = errShortBuffer
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(d.data)
+	d.data = d.data[8:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n == 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	if n < 0 {
+		d.err = errOverflow
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n == 0 {
+		d.err = errShortBuffer
+		return 0
+	}
+	if n < 0 {
+		d.err = errOverflow
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
@@ -0,0 +1,182 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBinary_RoundTrip(t *testing.T) {
+	for _, eps := range []float64{0.5, 0.1, 0.01, 0.001} {
+		t.Logf("eps:%v", eps)
+
+		r := NewRandom(eps)
+		Seed(r, rand.NormFloat64)
+		f := r.Finish()
+
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got FinishedRandom
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(f, got) {
+			t.Fatalf("round trip mismatch")
+		}
+
+		s_exp, s_got := f.Summarize(), got.Summarize()
+		for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+			if q_exp, q_got := s_exp.Query(ptile), s_got.Query(ptile); q_exp != q_got {
+				t.Fatalf("%0.2f: %v != %v", ptile, q_exp, q_got)
+			}
+		}
+	}
+}
+
+func TestBinary_Integers(t *testing.T) {
+	r := NewRandomOf[uint64](0.01)
+	for i := 0; i < 100000; i++ {
+		r.Add(math.MaxUint64 - uint64(rand.Intn(1000)))
+	}
+	f := r.Finish()
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FinishedRandomOf[uint64]
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, got) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	// the values can't be decoded as some other kind.
+	if err := new(FinishedRandomOf[int64]).UnmarshalBinary(data); err == nil {
+		t.Fatalf("expected error decoding as int64")
+	}
+	if err := new(FinishedRandom).UnmarshalBinary(data); err == nil {
+		t.Fatalf("expected error decoding as float64")
+	}
+}
+
+func TestBinary_Invalid(t *testing.T) {
+	r := NewRandom(0.1)
+	Seed(r, rand.NormFloat64)
+	good, err := r.Finish().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := func(f FinishedRandom) []byte {
+		data, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	cases := map[string][]byte{
+		"empty":     nil,
+		"version":   append([]byte{binaryVersion + 1}, good[1:]...),
+		"extremes":  encode(FinishedRandom{E: 0.5, N: 1, Min: 1, Max: 0}),
+		"truncated": good[:len(good)-1],
+		"trailing":  append(append([]byte(nil), good...), 0),
+		"epsilon":   encode(FinishedRandom{E: 1}),
+		"buffers": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: 0}, {Level: 0}, {Level: 0},
+		}}),
+		"length": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: 0, Data: []float64{1, 2, 3}},
+		}}),
+		"level": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: -2},
+		}}),
+		"nan": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: 0, Data: []float64{math.NaN()}},
+		}}),
+		"cleared": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: -1, Data: []float64{1}},
+		}}),
+		"sorted": encode(FinishedRandom{E: 0.5, Buffers: []Buffer{
+			{Level: 0, Data: []float64{2, 1}, Sorted: true},
+		}}),
+		"tiny epsilon": encode(FinishedRandom{E: 1e-12}),
+		"huge length":  hugeLengthBinary(0.1),
+		"hostile":      hugeLengthBinary(1e-300),
+	}
+
+	for name, data := range cases {
+		var got FinishedRandom
+		if err := got.UnmarshalBinary(data); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else {
+			t.Logf("%s: %v", name, err)
+		}
+	}
+}
+
+// hugeLengthBinary returns the encoding of a FinishedRandom with the epsilon
+// and one buffer that claims to hold 1<<40 values, but has no data.
+func hugeLengthBinary(eps float64) []byte {
+	data := []byte{binaryVersion, byte(kindFloat)}
+	data = binary.LittleEndian.AppendUint64(data, math.Float64bits(eps))
+	data = binary.AppendUvarint(data, 0)
+	data = append(data, make([]byte, 3*8)...)
+	data = binary.AppendUvarint(data, 0)
+	data = binary.AppendUvarint(data, 0)
+	data = binary.AppendUvarint(data, 0)
+	data = binary.AppendUvarint(data, 1)
+	data = binary.AppendVarint(data, 0)
+	data = append(data, 0)
+	return binary.AppendUvarint(data, 1<<40)
+}
+
+func FuzzBinary(f *testing.F) {
+	f.Add(hugeLengthBinary(1e-300))
+	for _, eps := range []float64{0.5, 0.1} {
+		r := NewRandom(eps)
+		for i := 0; i < 1000; i++ {
+			r.Add(rand.NormFloat64())
+		}
+		data, err := r.Finish().MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var r1 FinishedRandom
+		if err := r1.UnmarshalBinary(data); err != nil {
+			return
+		}
+		data1, err := r1.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r2 FinishedRandom
+		if err := r2.UnmarshalBinary(data1); err != nil {
+			t.Fatal(err)
+		}
+		data2, err := r2.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data1, data2) {
+			t.Fatalf("encoding not stable")
+		}
+
+		// anything that decodes should be able to be summarized.
+		r2.Summarize()
+	})
+}
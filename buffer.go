@@ -2,20 +2,26 @@
 
 package random
 
-import "sort"
+import (
+	"cmp"
+	"slices"
+)
 
-// Buffer represents some collected data at some level. The higher the level,
+// BufferOf represents some collected data at some level. The higher the level,
 // the more significant the data.
-type Buffer struct {
-	Data   []float64
+type BufferOf[T cmp.Ordered] struct {
+	Data   []T
 	Level  int32
 	Sorted bool
 }
 
+// Buffer is a BufferOf float64 values.
+type Buffer = BufferOf[float64]
+
 // newBuffer returns a new cleared buffer with the data slice as its backing
 // store.
-func newBuffer(data []float64) Buffer {
-	return Buffer{
+func newBuffer[T cmp.Ordered](data []T) BufferOf[T] {
+	return BufferOf[T]{
 		Data:   data[:0],
 		Level:  -1, // not full yet
 		Sorted: false,
@@ -23,14 +29,14 @@ func newBuffer(data []float64) Buffer {
 }
 
 // clear resets the buffer to the state as if it was just returned by newBuffer
-func (b *Buffer) clear() {
+func (b *BufferOf[T]) clear() {
 	b.Data = b.Data[:0]
 	b.Level = -1
 	b.Sorted = false
 }
 
 // sort sorts the buffer's data and flags the data as sorted.
-func (b *Buffer) sort() {
-	sort.Float64s(b.Data)
+func (b *BufferOf[T]) sort() {
+	slices.Sort(b.Data)
 	b.Sorted = true
 }
@@ -5,6 +5,7 @@ package random
 import (
 	"math"
 	"math/rand"
+	"testing"
 	"time"
 )
 
@@ -64,3 +65,14 @@ func Seed(r *Random, dist func() float64) {
 		r.Add(dist())
 	}
 }
+
+// expectPanic fails the test if fn doesn't panic.
+func expectPanic(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected panic")
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentRandom is a random quantile estimator that is safe to Add to from
+// many goroutines at once. It spreads the values across a number of shards,
+// each with their own Random and lock, and merges the shards when asked for
+// the result.
+type ConcurrentRandom struct {
+	shards []concurrentShard
+	next   atomic.Uint32 // the shard the next Add starts with
+
+	mu  sync.Mutex
+	pcg pcg // used to seed merges
+}
+
+// concurrentShard is a Random and the lock protecting it. it is padded out so
+// that shards next to each other don't share a cache line.
+type concurrentShard struct {
+	mu sync.Mutex
+	r  *Random
+	_  [48]byte
+}
+
+// NewConcurrentRandom calls NewConcurrentRandomWithSeed with a random seed
+// from math/rand.
+func NewConcurrentRandom(eps float64, shards int) *ConcurrentRandom {
+	return NewConcurrentRandomWithSeed(eps, shards, uint64(rand.Int63()))
+}
+
+// NewConcurrentRandomWithSeed constructs a ConcurrentRandom with the given
+// epsilon tolerance spread across the given number of shards. If shards is
+// not positive, runtime.GOMAXPROCS is used. The seed parameter lets one choose
+// what seed to use for the collection of the stream. It panics if the epsilon
+// is not within (0, 1) or is too small to allocate buffers for.
+func NewConcurrentRandomWithSeed(eps float64, shards int, seed uint64) (
+	c *ConcurrentRandom) {
+
+	mustValidEps(eps)
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+
+	c = &ConcurrentRandom{
+		shards: make([]concurrentShard, shards),
+		pcg:    newPCG(seed, 2),
+	}
+	for i := range c.shards {
+		c.shards[i].r = NewRandomWithSeed(eps, c.pcg.Uint64())
+	}
+	return c
+}
+
+// Add puts the value in the quantile estimator. It is safe to call from many
+// goroutines at once.
+func (c *ConcurrentRandom) Add(value float64) {
+	// pick the shards round robin, without looking at the value so that
+	// repeated values are spread out too, and walk to the next shard if that
+	// one is busy. it doesn't matter which shard a value ends up in because
+	// they all get merged together.
+	start := int(c.next.Add(1) % uint32(len(c.shards)))
+
+	for i, j := start, 0; j < len(c.shards); j++ {
+		shard := &c.shards[i]
+		if shard.mu.TryLock() {
+			shard.r.Add(value)
+			shard.mu.Unlock()
+			return
+		}
+		if i++; i == len(c.shards) {
+			i = 0
+		}
+	}
+
+	// everything was busy, so just wait on the one we started with.
+	shard := &c.shards[start]
+	shard.mu.Lock()
+	shard.r.Add(value)
+	shard.mu.Unlock()
+}
+
+// Snapshot returns a FinishedRandom that merges a snapshot of every shard. It
+// is safe to call concurrently with Add, and to continue calling Add after.
+func (c *ConcurrentRandom) Snapshot() FinishedRandom {
+	rs := make([]FinishedRandom, 0, len(c.shards))
+	for i := range c.shards {
+		shard := &c.shards[i]
+		shard.mu.Lock()
+		rs = append(rs, shard.r.Snapshot())
+		shard.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	seed := c.pcg.Uint64()
+	c.mu.Unlock()
+
+	return mergeSameEps(seed, rs[0], rs[1:]...)
+}
+
+// Summarize is a helper that returns a Summary for a ConcurrentRandom.
+func (c *ConcurrentRandom) Summarize() Summary {
+	return c.Snapshot().Summarize()
+}
@@ -0,0 +1,108 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestConcurrent_Normal(t *testing.T) {
+	const goroutines = 8
+	const count = 100000
+
+	c := NewConcurrentRandom(0.01, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(rand.Int63()))
+			for j := 0; j < count; j++ {
+				c.Add(rng.NormFloat64())
+			}
+		}()
+	}
+
+	// snapshots can be taken while values are being added.
+	for i := 0; i < 10; i++ {
+		c.Summarize()
+	}
+	wg.Wait()
+
+	f := c.Snapshot()
+	if f.N != goroutines*count {
+		t.Fatalf("expected %d values: %d", goroutines*count, f.N)
+	}
+
+	s := f.Summarize()
+	last := s.Query(0)
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		query := s.Query(ptile)
+		t.Logf("%0.2f,%v,%v", ptile, query, probit(ptile))
+		if query < last {
+			t.Fatalf("%v < %v", query, last)
+		}
+		last = query
+	}
+	if err := L1Norm(s, probit); err > 0.1 {
+		t.Fatalf("err too large: %v", err)
+	}
+}
+
+func TestConcurrent_BadEpsilon(t *testing.T) {
+	for _, eps := range []float64{0, 1, 2, 1e-300} {
+		expectPanic(t, func() { NewConcurrentRandom(eps, 1) })
+	}
+}
+
+//
+// benchmarks
+//
+
+func BenchmarkAddConcurrent(b *testing.B) {
+	c := NewConcurrentRandom(0.01, 0)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			c.Add(rng.NormFloat64())
+		}
+	})
+}
+
+func BenchmarkAddConcurrent_Constant(b *testing.B) {
+	c := NewConcurrentRandom(0.01, 0)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Add(1)
+		}
+	})
+}
+
+func BenchmarkAddMutex(b *testing.B) {
+	var mu sync.Mutex
+	r := NewRandom(0.01)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			value := rng.NormFloat64()
+			mu.Lock()
+			r.Add(value)
+			mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,150 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// decayTicks is how many times per half life a DecayingRandom decays the
+// values it has observed.
+const decayTicks = 8
+
+// DecayingRandom is a random quantile estimator where the weight of each value
+// decays exponentially with its age, so that recent values dominate without
+// any hard cutoff. Values are collected in a Random, and every tick the Random
+// is merged into an archive of the older values, whose buffers are decayed by
+// thinning them to the fraction of the decay factor.
+//
+// Buffers keep the integer weight of their level rather than being given a
+// fractional decayed weight, so that a Snapshot is an ordinary FinishedRandom
+// that can be merged and encoded. The decay is instead carried by how many
+// values are kept, so the ranks in its Summary come from the decayed weights
+// only in expectation, and N, Min, Max and Sum describe the values that were
+// kept. Thinning a buffer can move the rank of any value by up to the weight
+// of its level, which is added to the ExtraError every tick and decays along
+// with the values, so the RankErrorBound is looser than for a Random.
+//
+// Like Random, it is not safe to use from many goroutines at once.
+type DecayingRandom struct {
+	tick    int64 // nanoseconds
+	now     func() time.Time
+	cur     *Random
+	archive FinishedRandom
+	last    int64 // the index of the tick cur holds values for
+	pcg     pcg   // used to seed merges and thin the buffers
+}
+
+// NewDecayingRandom calls NewDecayingRandomWithClock with time.Now and a random
+// seed from math/rand.
+func NewDecayingRandom(eps float64, halfLife time.Duration) *DecayingRandom {
+	return NewDecayingRandomWithClock(eps, halfLife, time.Now,
+		uint64(rand.Int63()))
+}
+
+// NewDecayingRandomWithClock constructs a DecayingRandom with the given
+// epsilon tolerance where the weight of a value halves every halfLife, as
+// measured by the now function. The seed parameter lets one choose what seed
+// to use for the collection of the stream and the decay. It panics if the
+// epsilon is not within (0, 1) or is too small to allocate buffers for.
+func NewDecayingRandomWithClock(eps float64, halfLife time.Duration,
+	now func() time.Time, seed uint64) (d *DecayingRandom) {
+
+	mustValidEps(eps)
+	tick := int64(halfLife) / decayTicks
+	if tick <= 0 {
+		tick = 1
+	}
+
+	d = &DecayingRandom{
+		tick: tick,
+		now:  now,
+		archive: FinishedRandom{
+			E:   eps,
+			Min: math.Inf(1),
+			Max: math.Inf(-1),
+		},
+		last: epochOf(now(), tick),
+		pcg:  newPCG(seed, 4),
+	}
+	d.cur = NewRandomWithSeed(eps, d.pcg.Uint64())
+	return d
+}
+
+// advance moves the values from cur into the archive and decays them if any
+// ticks have passed since the values were added.
+func (d *DecayingRandom) advance() {
+	epoch := epochOf(d.now(), d.tick)
+	if epoch <= d.last {
+		return
+	}
+	ticks := epoch - d.last
+	d.last = epoch
+
+	d.archive = mergeSameEps(d.pcg.Uint64(), d.archive, d.cur.Snapshot())
+	d.decay(math.Exp2(-float64(ticks) / decayTicks))
+	d.cur.Reset(d.pcg.Uint64())
+}
+
+// decay scales the weight of the archive by the factor by thinning each of its
+// buffers to that fraction of their values. N becomes the weight of the values
+// that are kept, so that it stays consistent with the buffers.
+func (d *DecayingRandom) decay(factor float64) {
+	d.archive.N = 0
+	d.archive.ExtraError = int64(math.Ceil(
+		float64(d.archive.ExtraError) * factor))
+
+	for i := range d.archive.Buffers {
+		buf := &d.archive.Buffers[i]
+		if len(buf.Data) == 0 {
+			continue
+		}
+		d.thin(buf, factor)
+		d.archive.N += int64(len(buf.Data)) * levelWeight(buf.Level)
+
+		// the values kept from a sorted buffer are evenly spaced, so the
+		// rank of any value is off by less than the weight of one of them.
+		d.archive.ExtraError += levelWeight(buf.Level)
+	}
+	d.archive.Buffers = dropEmpty(d.archive.Buffers)
+	d.archive.estimateStats()
+}
+
+// thin keeps the given fraction of the values in the buffer, evenly spaced in
+// sorted order from a random offset, so that what is kept still represents
+// every part of the buffer.
+func (d *DecayingRandom) thin(buf *Buffer, factor float64) {
+	if !buf.Sorted {
+		buf.sort()
+	}
+
+	step := 1 / factor
+	n := 0
+	pos := float64(d.pcg.Uint32()) / (1 << 32) * step
+	for ; pos < float64(len(buf.Data)); pos += step {
+		buf.Data[n] = buf.Data[int(pos)]
+		n++
+	}
+	buf.Data = buf.Data[:n]
+}
+
+// Add puts the value in the quantile estimator at full weight.
+func (d *DecayingRandom) Add(value float64) {
+	d.advance()
+	d.cur.Add(value)
+}
+
+// Snapshot returns a FinishedRandom with the decayed values. It is safe to
+// continue calling Add after Snapshot.
+func (d *DecayingRandom) Snapshot() FinishedRandom {
+	d.advance()
+
+	return mergeSameEps(d.pcg.Uint64(), d.archive, d.cur.Snapshot())
+}
+
+// Summarize is a helper that returns a Summary for a DecayingRandom.
+func (d *DecayingRandom) Summarize() Summary {
+	return d.Snapshot().Summarize()
+}
@@ -0,0 +1,80 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDecaying(t *testing.T) {
+	now := time.Unix(1000, 0)
+	// seed everything so that the test is deterministic.
+	d := NewDecayingRandomWithClock(0.01, time.Minute,
+		func() time.Time { return now }, 2)
+	r := NewRandomWithSeed(0.01, 1)
+	rng := rand.New(rand.NewSource(3))
+
+	if !d.Summarize().Empty() {
+		t.Fatalf("expected empty summary")
+	}
+
+	add := func(minutes int, mean float64) {
+		for i := 0; i < minutes*1000; i++ {
+			value := mean + rng.NormFloat64()
+			d.Add(value)
+			r.Add(value)
+			now = now.Add(60 * time.Millisecond)
+		}
+	}
+
+	add(10, 0)
+	checkDecayedCount(t, d)
+	if median := d.Summarize().Query(0.5); median < -0.5 || median > 0.5 {
+		t.Fatalf("expected median near 0: %v", median)
+	}
+
+	// after two half lives of shifted values, only about a quarter of the
+	// weight is from the earlier values.
+	add(2, 10)
+	checkDecayedCount(t, d)
+	s := d.Summarize()
+	t.Logf("decaying median:%v random median:%v n:%d",
+		s.Query(0.5), r.Summarize().Query(0.5), d.Snapshot().N)
+	if median := s.Query(0.5); median < 9 {
+		t.Fatalf("expected median from the later values: %v", median)
+	}
+	if median := r.Summarize().Query(0.5); median > 1 {
+		t.Fatalf("expected undecayed median from the earlier values: %v", median)
+	}
+	if frac := s.CDF(5); frac < 0.15 || frac > 0.35 {
+		t.Fatalf("expected about a quarter of the weight below 5: %v", frac)
+	}
+
+	// long after, everything has decayed away.
+	now = now.Add(time.Hour)
+	if n := d.Snapshot().N; n != 0 {
+		t.Fatalf("expected all values to decay: %d", n)
+	}
+}
+
+func TestDecaying_BadEpsilon(t *testing.T) {
+	for _, eps := range []float64{0, 1, 2, 1e-300} {
+		expectPanic(t, func() { NewDecayingRandom(eps, time.Minute) })
+	}
+}
+
+// checkDecayedCount checks that the N of the decayed values is the weight of
+// the values kept in the buffers.
+func checkDecayedCount(t *testing.T, d *DecayingRandom) {
+	t.Helper()
+
+	weight := int64(0)
+	for _, buf := range d.archive.Buffers {
+		weight += int64(len(buf.Data)) * levelWeight(buf.Level)
+	}
+	if weight != d.archive.N {
+		t.Fatalf("decayed count %d != weight %d", d.archive.N, weight)
+	}
+}
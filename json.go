@@ -0,0 +1,271 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// jsonFloat is a float64 that can be encoded to JSON even when it is NaN or
+// infinite. Those values are encoded as the strings "NaN", "+Inf" and "-Inf"
+// and every other value is encoded as a number.
+type jsonFloat float64
+
+// MarshalJSON implements json.Marshaler.
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	switch v := float64(f); {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	default:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *jsonFloat) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"NaN"`:
+		*f = jsonFloat(math.NaN())
+		return nil
+	case `"+Inf"`, `"Inf"`:
+		*f = jsonFloat(math.Inf(1))
+		return nil
+	case `"-Inf"`:
+		*f = jsonFloat(math.Inf(-1))
+		return nil
+	}
+
+	v, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return fmt.Errorf("bad encoding: invalid float %q", data)
+	}
+	*f = jsonFloat(v)
+	return nil
+}
+
+// jsonValue is a Value that is encoded as a jsonFloat for floating point types
+// and as an integer otherwise.
+type jsonValue[T Value] struct {
+	v T
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v jsonValue[T]) MarshalJSON() ([]byte, error) {
+	switch kindOf[T]() {
+	case kindFloat:
+		return jsonFloat(v.v).MarshalJSON()
+	case kindInt:
+		return strconv.AppendInt(nil, int64(v.v), 10), nil
+	default:
+		return strconv.AppendUint(nil, uint64(v.v), 10), nil
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (v *jsonValue[T]) UnmarshalJSON(data []byte) error {
+	switch kindOf[T]() {
+	case kindFloat:
+		var f jsonFloat
+		if err := f.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		v.v = T(f)
+	case kindInt:
+		i, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad encoding: invalid integer %q", data)
+		}
+		v.v = T(i)
+	default:
+		u, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad encoding: invalid integer %q", data)
+		}
+		v.v = T(u)
+	}
+	return nil
+}
+
+// toJSONValues converts the values into jsonValues.
+func toJSONValues[T Value](values []T) []jsonValue[T] {
+	out := make([]jsonValue[T], len(values))
+	for i, v := range values {
+		out[i] = jsonValue[T]{v}
+	}
+	return out
+}
+
+// fromJSONValues converts the jsonValues into values.
+func fromJSONValues[T Value](values []jsonValue[T]) []T {
+	out := make([]T, len(values))
+	for i, v := range values {
+		out[i] = v.v
+	}
+	return out
+}
+
+// jsonBuffer is the JSON representation of a Buffer.
+type jsonBuffer[T Value] struct {
+	Data   []jsonValue[T]
+	Level  int32
+	Sorted bool
+}
+
+// jsonFinishedRandom is the JSON representation of a FinishedRandom. It uses
+// the same field names as the default encoding of the struct so that values
+// encoded before MarshalJSON existed can still be decoded.
+type jsonFinishedRandom[T Value] struct {
+	E       jsonFloat
+	N       int64
+	Buffers []jsonBuffer[T]
+
+	// these are pointers so that we can tell if they are missing from
+	// values encoded before they were tracked, and estimate them instead.
+	Min *jsonValue[T]
+	Max *jsonValue[T]
+	Sum *jsonFloat
+
+	NaNs       int64
+	Infs       int64
+	ExtraError int64
+}
+
+// MarshalJSON implements json.Marshaler.
+func (r FinishedRandomOf[T]) MarshalJSON() ([]byte, error) {
+	min, max, sum := jsonValue[T]{r.Min}, jsonValue[T]{r.Max}, jsonFloat(r.Sum)
+	out := jsonFinishedRandom[T]{
+		E:       jsonFloat(r.E),
+		N:       r.N,
+		Buffers: make([]jsonBuffer[T], 0, len(r.Buffers)),
+		Min:     &min,
+		Max:     &max,
+		Sum:     &sum,
+		NaNs:    r.NaNs,
+		Infs:    r.Infs,
+
+		ExtraError: r.ExtraError,
+	}
+	for _, buf := range r.Buffers {
+		out.Buffers = append(out.Buffers, jsonBuffer[T]{
+			Data:   toJSONValues(buf.Data),
+			Level:  buf.Level,
+			Sorted: buf.Sorted,
+		})
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It validates that the decoded
+// value could have been produced by a Random or by Merge.
+func (r *FinishedRandomOf[T]) UnmarshalJSON(data []byte) error {
+	var in jsonFinishedRandom[T]
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	out := FinishedRandomOf[T]{
+		E:       float64(in.E),
+		N:       in.N,
+		Buffers: make([]BufferOf[T], 0, len(in.Buffers)),
+		NaNs:    in.NaNs,
+		Infs:    in.Infs,
+
+		ExtraError: in.ExtraError,
+	}
+	for _, buf := range in.Buffers {
+		out.Buffers = append(out.Buffers, BufferOf[T]{
+			Data:   fromJSONValues(buf.Data),
+			Level:  buf.Level,
+			Sorted: buf.Sorted,
+		})
+	}
+	if in.Min == nil || in.Max == nil || in.Sum == nil {
+		out.estimateStats()
+	} else {
+		out.Min, out.Max, out.Sum = in.Min.v, in.Max.v, float64(*in.Sum)
+	}
+	if err := out.validate(); err != nil {
+		return err
+	}
+
+	*r = out
+	return nil
+}
+
+// jsonSummaryElement is the JSON representation of a summaryElement.
+type jsonSummaryElement[T Value] struct {
+	Rank  int64
+	Value jsonValue[T]
+}
+
+// jsonSummary is the JSON representation of a Summary.
+type jsonSummary[T Value] struct {
+	N        jsonFloat
+	Elements []jsonSummaryElement[T]
+
+	// these are pointers so that we can tell if they are missing, since a
+	// Summary can't be queried without them.
+	Min *jsonValue[T]
+	Max *jsonValue[T]
+	Sum *jsonFloat
+
+	Bound int64
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s SummaryOf[T]) MarshalJSON() ([]byte, error) {
+	min, max, sum := jsonValue[T]{s.min}, jsonValue[T]{s.max}, jsonFloat(s.sum)
+	out := jsonSummary[T]{
+		N:        jsonFloat(s.n),
+		Elements: make([]jsonSummaryElement[T], 0, len(s.elements)),
+		Min:      &min,
+		Max:      &max,
+		Sum:      &sum,
+		Bound:    s.bound,
+	}
+	for _, ele := range s.elements {
+		out.Elements = append(out.Elements, jsonSummaryElement[T]{
+			Rank:  ele.rank,
+			Value: jsonValue[T]{ele.value},
+		})
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The decoded Summary can be
+// queried without the FinishedRandom it was created from.
+func (s *SummaryOf[T]) UnmarshalJSON(data []byte) error {
+	var in jsonSummary[T]
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	out := SummaryOf[T]{summaryCore: summaryCore[T]{
+		n:        float64(in.N),
+		elements: make([]summaryElement[T], 0, len(in.Elements)),
+		bound:    in.Bound,
+	}}
+	for _, ele := range in.Elements {
+		out.elements = append(out.elements, summaryElement[T]{
+			rank:  ele.Rank,
+			value: ele.Value.v,
+		})
+	}
+	if in.Min == nil || in.Max == nil || in.Sum == nil {
+		return fmt.Errorf("bad summary: missing min, max or sum")
+	}
+	out.min, out.max, out.sum = in.Min.v, in.Max.v, float64(*in.Sum)
+	if err := out.validate(); err != nil {
+		return err
+	}
+
+	*s = out
+	return nil
+}
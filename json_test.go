@@ -0,0 +1,162 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestJSON_FinishedRandom(t *testing.T) {
+	r := NewRandom(0.1)
+	Seed(r, rand.NormFloat64)
+	r.Add(math.Inf(1))
+	r.Add(math.Inf(-1))
+	f := r.Finish()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FinishedRandom
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sum is NaN, so compare the encodings instead of the values.
+	data_got, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(data_got) {
+		t.Fatalf("round trip mismatch")
+	}
+}
+
+func TestJSON_Integers(t *testing.T) {
+	r := NewRandomOf[int64](0.1)
+	for i := 0; i < 100000; i++ {
+		r.Add(math.MinInt64 + rand.Int63n(1000))
+	}
+	f := r.Finish()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FinishedRandomOf[int64]
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f, got) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	s := f.Summarize()
+	data, err = json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got_s SummaryOf[int64]
+	if err := json.Unmarshal(data, &got_s); err != nil {
+		t.Fatal(err)
+	}
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		if q_exp, q_got := s.Query(ptile), got_s.Query(ptile); q_exp != q_got {
+			t.Fatalf("%0.2f: %v != %v", ptile, q_exp, q_got)
+		}
+	}
+}
+
+func TestJSON_FinishedRandomDefault(t *testing.T) {
+	// values encoded with the default struct encoding before Min, Max and Sum
+	// existed should still decode.
+	type finishedRandom struct {
+		E       float64
+		N       int64
+		Buffers []Buffer
+	}
+
+	r := NewRandom(0.1)
+	Seed(r, rand.NormFloat64)
+	f := r.Finish()
+
+	data, err := json.Marshal(finishedRandom{E: f.E, N: f.N, Buffers: f.Buffers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got FinishedRandom
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.E != f.E || got.N != f.N || !reflect.DeepEqual(got.Buffers, f.Buffers) {
+		t.Fatalf("round trip mismatch")
+	}
+
+	// the statistics are estimated from the buffers.
+	exp := FinishedRandom{Buffers: f.Buffers}
+	exp.estimateStats()
+	if got.Min != exp.Min || got.Max != exp.Max || got.Sum != exp.Sum {
+		t.Fatalf("expected estimated statistics")
+	}
+	if got.Min < f.Min || got.Max > f.Max {
+		t.Fatalf("estimated extremes outside of exact ones")
+	}
+}
+
+func TestJSON_Summary(t *testing.T) {
+	r := NewRandom(0.01)
+	Seed(r, rand.NormFloat64)
+	r.Add(math.Inf(1))
+	s := r.Summarize()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Summary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		if q_exp, q_got := s.Query(ptile), got.Query(ptile); q_exp != q_got {
+			t.Fatalf("%0.2f: %v != %v", ptile, q_exp, q_got)
+		}
+	}
+}
+
+func TestJSON_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"epsilon": `{"E":"NaN","N":0,"Buffers":[]}`,
+		"float":   `{"E":"bad","N":0,"Buffers":[]}`,
+		"sorted":  `{"E":0.5,"N":2,"Buffers":[{"Data":[2,1],"Level":0,"Sorted":true}]}`,
+	}
+	for name, data := range cases {
+		var got FinishedRandom
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else {
+			t.Logf("%s: %v", name, err)
+		}
+	}
+
+	cases = map[string]string{
+		"count": `{"N":-1,"Elements":[]}`,
+		"rank":  `{"N":2,"Elements":[{"Rank":1,"Value":1},{"Rank":1,"Value":2}]}`,
+		"value": `{"N":2,"Elements":[{"Rank":0,"Value":2},{"Rank":1,"Value":1}]}`,
+		"nan":   `{"N":1,"Elements":[{"Rank":0,"Value":"NaN"}],"Min":0,"Max":0,"Sum":0}`,
+		"stats": `{"N":3,"Elements":[{"Rank":0,"Value":5},{"Rank":1,"Value":6}]}`,
+	}
+	for name, data := range cases {
+		var got Summary
+		if err := json.Unmarshal([]byte(data), &got); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else {
+			t.Logf("%s: %v", name, err)
+		}
+	}
+}
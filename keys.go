@@ -0,0 +1,225 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"cmp"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// KeyRandom is a random quantile estimator for keys that can only be ordered,
+// like strings, such as to pick split points for partitioning a range of keys.
+// Byte slice keys can be added by converting them to strings. Since keys can't
+// be summed or interpolated, it doesn't track a sum and queries return keys
+// that were observed. NaN keys have no place in the ordering and are dropped.
+type KeyRandom[K cmp.Ordered] struct {
+	sampler[K]
+
+	// these values keep track of the exact extremes of everything observed,
+	// since the buffers only hold a sample.
+	min K
+	max K
+}
+
+// NewKeyRandom calls NewKeyRandomWithSeed with a random seed from math/rand.
+func NewKeyRandom[K cmp.Ordered](eps float64) *KeyRandom[K] {
+	return NewKeyRandomWithSeed[K](eps, uint64(rand.Int63()))
+}
+
+// NewKeyRandomWithSeed constructs a KeyRandom with the given epsilon tolerance
+// for changes in the CDF. The seed parameter lets one choose what seed to use
+// for the collection of the stream.
+func NewKeyRandomWithSeed[K cmp.Ordered](eps float64, seed uint64) (
+	r *KeyRandom[K]) {
+
+	r = &KeyRandom[K]{sampler: newSampler[K](eps)}
+	r.Reset(seed)
+	return r
+}
+
+// Reset returns the KeyRandom to the state it was in when it was constructed,
+// but with the given seed, reusing all of its memory. As with Random, anything
+// returned by Finish must no longer be in use.
+func (r *KeyRandom[K]) Reset(seed uint64) {
+	var zero K
+	r.reset(seed)
+	r.min, r.max = zero, zero
+}
+
+// Epsilon returns the epsilon the KeyRandom was constructed with.
+func (r *KeyRandom[K]) Epsilon() float64 {
+	return r.e
+}
+
+// Add puts the key in the quantile estimator.
+func (r *KeyRandom[K]) Add(key K) {
+	if key != key {
+		return
+	}
+	if r.n == 0 || key < r.min {
+		r.min = key
+	}
+	if r.n == 0 || key > r.max {
+		r.max = key
+	}
+	r.add(key)
+}
+
+// Summarize is a helper that returns a KeySummary for a KeyRandom. It is safe
+// to continue calling Add after Summarize.
+func (r *KeyRandom[K]) Summarize() KeySummary[K] {
+	return r.Snapshot().Summarize()
+}
+
+// FinishedKeyRandom represents a full collection of a KeyRandom value.
+type FinishedKeyRandom[K cmp.Ordered] struct {
+	E       float64
+	N       int64
+	Buffers []BufferOf[K]
+
+	// Min and Max are the exact minimum and maximum observed keys. They are
+	// the zero value if nothing was observed.
+	Min K
+	Max K
+
+	// ExtraError is how far the rank of any key may be off from the
+	// guarantee given by E because of resampling done by MergeKeys.
+	ExtraError int64
+}
+
+// Finish returns a FinishedKeyRandom that can be merged and summarized. It is
+// unsafe to call Add on KeyRandom after Finish has been called.
+func (r *KeyRandom[K]) Finish() FinishedKeyRandom[K] {
+	return FinishedKeyRandom[K]{
+		E:       r.e,
+		N:       r.n,
+		Buffers: r.buffers,
+		Min:     r.min,
+		Max:     r.max,
+	}
+}
+
+// Snapshot returns a FinishedKeyRandom that is a deep copy of the current
+// state of the KeyRandom. It is safe to continue calling Add after Snapshot.
+func (r *KeyRandom[K]) Snapshot() FinishedKeyRandom[K] {
+	return FinishedKeyRandom[K]{
+		E:       r.e,
+		N:       r.n,
+		Buffers: copyBuffers(r.buffers),
+		Min:     r.min,
+		Max:     r.max,
+	}
+}
+
+// MergeKeys is like Merge but for FinishedKeyRandoms.
+func MergeKeys[K cmp.Ordered](seed uint64, r FinishedKeyRandom[K],
+	rs ...FinishedKeyRandom[K]) (out FinishedKeyRandom[K], err error) {
+
+	// special case merging one random as the identity function
+	if len(rs) == 0 {
+		return r, nil
+	}
+
+	out = r
+	parts := make([]mergePart[K], 0, 1+len(rs))
+	parts = append(parts, mergePart[K]{r.E, r.Buffers, r.ExtraError})
+	for _, r := range rs {
+		// the extremes of an empty input are meaningless.
+		if r.N > 0 && (out.N == 0 || r.Min < out.Min) {
+			out.Min = r.Min
+		}
+		if r.N > 0 && (out.N == 0 || r.Max > out.Max) {
+			out.Max = r.Max
+		}
+		out.N += r.N
+		parts = append(parts, mergePart[K]{r.E, r.Buffers, r.ExtraError})
+	}
+
+	merged, err := mergeParts(seed, parts)
+	if err != nil {
+		return out, err
+	}
+	out.E, out.Buffers, out.ExtraError = merged.e, merged.buffers, merged.extra
+	return out, nil
+}
+
+// KeySummary is produced by a KeyRandom and can answer queries about the
+// distribution of keys that was observed.
+type KeySummary[K cmp.Ordered] struct {
+	summaryCore[K]
+}
+
+// Summarize creates a KeySummary for querying.
+func (r FinishedKeyRandom[K]) Summarize() KeySummary[K] {
+	elements := make([]summaryElement[K], 0, numElements(r.Buffers))
+	return KeySummary[K]{summaryCore[K]{
+		n:        float64(r.N),
+		elements: summarizeBuffers(r.Buffers, elements),
+
+		min: r.Min,
+		max: r.Max,
+
+		bound: int64(math.Ceil(r.E*float64(r.N))) + r.ExtraError,
+	}}
+}
+
+// Query returns an observed key estimated to be at the given percentile: the
+// key whose rank is the largest that is not above the target. The 0th and
+// 100th percentiles are the exact minimum and maximum observed keys, and
+// percentiles outside of [0, 1] are clamped to them. It returns the zero value
+// if the KeySummary is empty or the percentile is NaN.
+func (s KeySummary[K]) Query(ptile float64) K {
+	key, _ := s.QueryOK(ptile)
+	return key
+}
+
+// QueryOK is like Query but reports false if the KeySummary is empty or the
+// percentile is NaN.
+func (s KeySummary[K]) QueryOK(ptile float64) (key K, ok bool) {
+	return s.lookup(ptile, func(target int64) K {
+		idx := s.search(target)
+		switch {
+		case idx >= len(s.elements):
+			idx = len(s.elements) - 1
+		case idx > 0 && s.elements[idx].rank > target:
+			idx--
+		}
+		return s.elements[idx].value
+	})
+}
+
+// Rank returns the estimated number of observed keys less than the given key.
+// It returns 0 if the key is NaN.
+func (s KeySummary[K]) Rank(key K) int64 {
+	if key != key {
+		return 0
+	}
+	idx := sort.Search(len(s.elements), func(idx int) bool {
+		return s.elements[idx].value >= key
+	})
+	// a merge can leave more weight in the buffers than was observed, so
+	// keep the rank within N.
+	if idx >= len(s.elements) || s.elements[idx].rank > int64(s.n) {
+		return int64(s.n)
+	}
+	return s.elements[idx].rank
+}
+
+// CDF returns the estimated fraction of observed keys less than the given key,
+// or NaN if the KeySummary is empty or the key is NaN.
+func (s KeySummary[K]) CDF(key K) float64 {
+	if s.Empty() || key != key {
+		return math.NaN()
+	}
+	return float64(s.Rank(key)) / s.n
+}
+
+// Min returns the exact minimum observed key, or the zero value if nothing was
+// observed.
+func (s KeySummary[K]) Min() K { return s.min }
+
+// Max returns the exact maximum observed key, or the zero value if nothing was
+// observed.
+func (s KeySummary[K]) Max() K { return s.max }
@@ -0,0 +1,129 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestKeyRandom(t *testing.T) {
+	const n = 100000
+	key := func(i int) string { return fmt.Sprintf("key%08d", i) }
+
+	r := NewKeyRandom[string](0.01)
+	if !r.Summarize().Empty() {
+		t.Fatalf("expected empty summary")
+	}
+	for _, i := range rand.Perm(n) {
+		r.Add(key(i))
+	}
+	s := r.Summarize()
+
+	if s.Min() != key(0) || s.Max() != key(n-1) {
+		t.Fatalf("bad extremes: %q %q", s.Min(), s.Max())
+	}
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		got := s.Query(ptile)
+		var idx int
+		if _, err := fmt.Sscanf(got, "key%d", &idx); err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(float64(idx)-ptile*n) > 0.01*n {
+			t.Fatalf("%0.2f: %q", ptile, got)
+		}
+		if cdf := s.CDF(got); math.Abs(cdf-ptile) > 0.01 {
+			t.Fatalf("%0.2f: cdf %v", ptile, cdf)
+		}
+	}
+}
+
+func TestKeyRandom_Merge(t *testing.T) {
+	// split the keys by their first byte, so that each input only has some of
+	// the range.
+	rs := make([]FinishedKeyRandom[string], 4)
+	for i := range rs {
+		r := NewKeyRandom[string](0.01)
+		for j := 0; j < 10000*(i+1); j++ {
+			r.Add(string([]byte{byte('a' + i), byte(rand.Intn(256))}))
+		}
+		rs[i] = r.Finish()
+	}
+
+	// the empty one is ignored for the extremes.
+	empty := NewKeyRandom[string](0.01).Finish()
+	f, err := MergeKeys(0, empty, rs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.N != 100000 || f.Min[0] != 'a' || f.Max[0] != 'd' {
+		t.Fatalf("bad merge: n:%d min:%q max:%q", f.N, f.Min, f.Max)
+	}
+
+	// a fifth of the keys start with 'c' and three fifths are before it.
+	s := f.Summarize()
+	if cdf := s.CDF("c"); math.Abs(cdf-0.3) > 0.02 {
+		t.Fatalf("bad cdf: %v", cdf)
+	}
+	if median := s.Query(0.5); median[0] != 'c' {
+		t.Fatalf("bad median: %q", median)
+	}
+}
+
+func TestKeyRandom_MergeRank(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	epss := []float64{0.001, 0.01, 0.05, 0.1}
+
+	for seed := 0; seed < 100; seed++ {
+		rs := make([]FinishedKeyRandom[int], 1+rng.Intn(6))
+		for i := range rs {
+			r := NewKeyRandomWithSeed[int](epss[rng.Intn(len(epss))],
+				rng.Uint64())
+			for j := rng.Intn(20000); j > 0; j-- {
+				r.Add(rng.Intn(1000))
+			}
+			rs[i] = r.Finish()
+		}
+		f, err := MergeKeys(uint64(seed), rs[0], rs[1:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := f.Summarize()
+		for key := 0; key <= 1000; key += 10 {
+			if rank := s.Rank(key); rank < 0 || rank > f.N {
+				t.Fatalf("rank of %d is %d of %d", key, rank, f.N)
+			}
+		}
+	}
+}
+
+func TestKeyRandom_SplitPoints(t *testing.T) {
+	r := NewKeyRandom[string](0.01)
+	for i := 0; i < 100000; i++ {
+		r.Add(fmt.Sprintf("%c%04d", 'a'+rand.Intn(26), rand.Intn(10000)))
+	}
+
+	splits, counts := r.Summarize().SplitPoints(26)
+	for i, count := range counts {
+		if math.Abs(float64(count)-100000/26) > 0.02*100000 {
+			t.Fatalf("range %d bad count %d", i, count)
+		}
+	}
+	for i, split := range splits {
+		if split[0] != byte('b'+i) && split[0] != byte('a'+i) {
+			t.Fatalf("split %d bad key %q", i, split)
+		}
+	}
+}
+
+func TestKeyRandom_NaN(t *testing.T) {
+	r := NewKeyRandom[float64](0.1)
+	r.Add(math.NaN())
+	r.Add(1)
+	r.Add(math.NaN())
+	if f := r.Finish(); f.N != 1 || f.Min != 1 || f.Max != 1 {
+		t.Fatalf("expected NaN keys to be dropped: %+v", f)
+	}
+}
@@ -3,78 +3,190 @@
 package random
 
 import (
+	"cmp"
 	"fmt"
 	"sort"
 )
 
 // Merge will merge the specified rs into a new FinishedRandom so that it is as
-// if the result observed all of the values from the passed in rs. It will
-// error if any of the epsilon values are different for the FinishedRandoms.
-func Merge(seed uint64, r FinishedRandom, rs ...FinishedRandom) (
-	out FinishedRandom, err error) {
+// if the result observed all of the values from the passed in rs. The
+// FinishedRandoms may have been created with different epsilons, in which case
+// the finer ones are resampled down to the buffer size of the coarsest one and
+// the result has the coarsest epsilon as its E. Any resampling that the
+// Random algorithm would not have done adds to the ExtraError of the result.
+// It will error if any of the epsilon values are invalid.
+func Merge[T Value](seed uint64, r FinishedRandomOf[T],
+	rs ...FinishedRandomOf[T]) (out FinishedRandomOf[T], err error) {
 
 	// special case merging one random as the identity function
 	if len(rs) == 0 {
 		return r, nil
 	}
 
-	out = r
-	b, s := paramsFromEps(out.E)
-	buffers := make([]Buffer, 0, b*(1+len(rs)))
-	merger := newBufferMerger(make([]float64, s), newPCG(seed, 0))
-	buffers = append(buffers, copyBuffers(r.Buffers)...)
+	// the extremes of an empty input are meaningless, so start from the
+	// extremes of nothing observed.
+	out.Max, out.Min = extremes[T]()
+	parts := make([]mergePart[T], 0, 1+len(rs))
+	for _, r := range append([]FinishedRandomOf[T]{r}, rs...) {
+		out.N += r.N
+		out.Sum += r.Sum
+		out.NaNs += r.NaNs
+		out.Infs += r.Infs
+		if r.N > 0 && r.Min < out.Min {
+			out.Min = r.Min
+		}
+		if r.N > 0 && r.Max > out.Max {
+			out.Max = r.Max
+		}
+		parts = append(parts, mergePart[T]{r.E, r.Buffers, r.ExtraError})
+	}
+
+	merged, err := mergeParts(seed, parts)
+	if err != nil {
+		return out, err
+	}
+	out.E, out.Buffers, out.ExtraError = merged.e, merged.buffers, merged.extra
+	return out, nil
+}
+
+// mergePart is what merging needs from each of the finished randoms.
+type mergePart[T cmp.Ordered] struct {
+	e       float64
+	buffers []BufferOf[T]
+	extra   int64
+}
+
+// mergeParts merges copies of the buffers of the parts, returning them along
+// with the coarsest epsilon and the total extra error, including any added by
+// resampling. It will error if any of the epsilon values are invalid.
+func mergeParts[T cmp.Ordered](seed uint64, parts []mergePart[T]) (
+	out mergePart[T], err error) {
 
-	for _, r := range rs {
-		if out.E != r.E {
-			return out, fmt.Errorf("bad merge: e1:%v e2:%v", out.E, r.E)
+	// the merged result can be no more accurate than the coarsest input.
+	for _, part := range parts {
+		if !(part.e > 0 && part.e < 1) {
+			return out, fmt.Errorf("bad merge: e:%v", part.e)
+		}
+		if part.e > out.e {
+			out.e = part.e
+		}
+		out.extra += part.extra
+	}
+
+	b, _ := paramsFromEps(out.e)
+	buffers := make([]BufferOf[T], 0, b*len(parts))
+	for _, part := range parts {
+		buffers = append(buffers, copyBuffers(part.buffers)...)
+	}
+
+	var extra int64
+	out.buffers, extra = mergeBuffers(seed, out.e, buffers)
+	out.extra += extra
+	return out, nil
+}
+
+// mergeSameEps merges FinishedRandoms that all have the same epsilon, such as
+// the parts of a ConcurrentRandom, WindowedRandom or DecayingRandom. Merge can
+// only fail for invalid epsilons, which their constructors reject with
+// mustValidEps.
+func mergeSameEps[T Value](seed uint64, r FinishedRandomOf[T],
+	rs ...FinishedRandomOf[T]) FinishedRandomOf[T] {
+
+	out, _ := Merge(seed, r, rs...)
+	return out
+}
+
+// mergeBuffers combines the buffers, which it owns, until they fit in the
+// buffers of a Random with the given epsilon, returning them along with how
+// far the rank of any value may be off because of resampling that the Random
+// algorithm would not have done.
+func mergeBuffers[T cmp.Ordered](seed uint64, eps float64,
+	buffers []BufferOf[T]) (_ []BufferOf[T], extra int64) {
+
+	b, s := paramsFromEps(eps)
+	merger := newBufferMerger(make([]T, s), newPCG(seed, 0))
+
+	// resample any buffers from finer inputs until they fit in the buffer
+	// size of the output.
+	for i := range buffers {
+		buf := &buffers[i]
+		if len(buf.Data) <= s {
+			continue
+		}
+		if !buf.Sorted {
+			buf.sort()
+		}
+		for len(buf.Data) > s {
+			extra += levelWeight(buf.Level)
+			merger.halve(buf)
 		}
-		out.N += r.N
-		buffers = append(buffers, copyBuffers(r.Buffers)...)
 	}
 
 	for {
-		merged := false
-		sort.Sort(byLevel(buffers))
+		changed := false
+		buffers = dropEmpty(buffers)
+		sort.Sort(byLevel[T](buffers))
 
 		for i := 0; i < len(buffers)-1; i++ {
-			// attempt to merge buffers[i] and buffers[i+1]
+			// attempt to combine buffers[i] and buffers[i+1]
 			bl, bh := &buffers[i], &buffers[i+1]
-			if bl.Level == -1 || bh.Level == -1 || bl.Level != bh.Level {
+			if len(bl.Data) == 0 || len(bh.Data) == 0 || bl.Level != bh.Level {
 				continue
 			}
-			if len(bl.Data) != s || len(bh.Data) != s {
+			changed = true
+
+			// if both fit in a single buffer, move the values from the lower
+			// one into the higher one. they are at the same level so this
+			// doesn't change what they represent.
+			if len(bl.Data)+len(bh.Data) <= s {
+				bh.Data = append(bh.Data, bl.Data...)
+				bh.Sorted = false
+				bl.clear()
 				continue
 			}
 
+			// otherwise merge them into the next level, which keeps half of
+			// the values from both whether or not they are full. merging
+			// full buffers is what the Random algorithm would do, so only
+			// partial ones add error.
+			if len(bl.Data) < s || len(bh.Data) < s {
+				extra += levelWeight(bh.Level)
+			}
 			if !bl.Sorted {
 				bl.sort()
 			}
 			if !bh.Sorted {
 				bh.sort()
 			}
-
-			merged = true
 			merger.merge(bh, bl)
 		}
 
-		if !merged {
+		if changed {
+			continue
+		}
+
+		// every level has at most one buffer now. if there are still too many
+		// buffers, halve the lowest one so that it gets combined with the one
+		// above it.
+		if len(buffers) <= b {
 			break
 		}
+		if !buffers[0].Sorted {
+			buffers[0].sort()
+		}
+		extra += levelWeight(buffers[0].Level)
+		merger.halve(&buffers[0])
 	}
 
-	// take the b largest buffers out and use them
-	sort.Sort(byLevel(buffers))
-	out.Buffers = buffers[len(buffers)-b:]
-
-	return out, nil
+	return buffers, extra
 }
 
 // copyBuffers returns a deep copy of all of the buffers in the given slice.
-func copyBuffers(buffers []Buffer) []Buffer {
-	out := make([]Buffer, 0, len(buffers))
+func copyBuffers[T cmp.Ordered](buffers []BufferOf[T]) []BufferOf[T] {
+	out := make([]BufferOf[T], 0, len(buffers))
 	for _, buf := range buffers {
-		out = append(out, Buffer{
-			Data:   append([]float64(nil), buf.Data...),
+		out = append(out, BufferOf[T]{
+			Data:   append([]T(nil), buf.Data...),
 			Level:  buf.Level,
 			Sorted: buf.Sorted,
 		})
@@ -82,9 +194,27 @@ func copyBuffers(buffers []Buffer) []Buffer {
 	return out
 }
 
+// levelWeight returns the number of observations each value in a buffer at the
+// level stands for. it is also the most that the rank of any value can change
+// by when resampling the buffer.
+func levelWeight(level int32) int64 {
+	return 1 << uint(level)
+}
+
+// dropEmpty removes the buffers without any data from the slice in place.
+func dropEmpty[T cmp.Ordered](buffers []BufferOf[T]) []BufferOf[T] {
+	out := buffers[:0]
+	for _, buf := range buffers {
+		if len(buf.Data) > 0 {
+			out = append(out, buf)
+		}
+	}
+	return out
+}
+
 // byLevel sorts a slice of Buffers by their level, lowest first.
-type byLevel []Buffer
+type byLevel[T cmp.Ordered] []BufferOf[T]
 
-func (b byLevel) Len() int           { return len(b) }
-func (b byLevel) Less(i, j int) bool { return b[i].Level < b[j].Level }
-func (b byLevel) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLevel[T]) Len() int           { return len(b) }
+func (b byLevel[T]) Less(i, j int) bool { return b[i].Level < b[j].Level }
+func (b byLevel[T]) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -2,15 +2,17 @@
 
 package random
 
+import "cmp"
+
 // bufferMerger is a thing that can merge two buffers
-type bufferMerger struct {
+type bufferMerger[T cmp.Ordered] struct {
 	coin    coin
-	scratch []float64
+	scratch []T
 }
 
 // newBufferMerger creates a buffer merger with the associated scratch space
-func newBufferMerger(scratch []float64, pcg pcg) *bufferMerger {
-	return &bufferMerger{
+func newBufferMerger[T cmp.Ordered](scratch []T, pcg pcg) *bufferMerger[T] {
+	return &bufferMerger[T]{
 		scratch: scratch,
 		coin: coin{
 			pcg: pcg,
@@ -18,11 +20,12 @@ func newBufferMerger(scratch []float64, pcg pcg) *bufferMerger {
 	}
 }
 
-// merge takes half of the values in b and puts them into a. the slices should
-// be sorted.
-func (b *bufferMerger) merge(dst, other *Buffer) {
+// merge takes half of the values in both dst and other and puts them into dst.
+// the slices should be sorted, and together hold at most twice the length of
+// the scratch space.
+func (b *bufferMerger[T]) merge(dst, other *BufferOf[T]) {
 	b.scratch = b.scratch[:0]
-	merge := newMergeSorter([]mergeItem{
+	merge := newMergeSorter([]mergeItem[T]{
 		{data: dst.Data},
 		{data: other.Data},
 	})
@@ -41,6 +44,24 @@ func (b *bufferMerger) merge(dst, other *Buffer) {
 	// increment the level and clear the other one.
 	dst.Level++
 	dst.Sorted = true
-	copy(dst.Data, b.scratch)
+	dst.Data = append(dst.Data[:0], b.scratch...)
 	other.clear()
 }
+
+// halve keeps half of the values in the sorted buffer, choosing which half
+// with a coin toss, and increments its level so that each remaining value
+// stands for twice as many observations.
+func (b *bufferMerger[T]) halve(buf *BufferOf[T]) {
+	use := b.coin.toss()
+	n := 0
+	for _, value := range buf.Data {
+		if use {
+			buf.Data[n] = value
+			n++
+		}
+		use = !use
+	}
+
+	buf.Data = buf.Data[:n]
+	buf.Level++
+}
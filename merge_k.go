@@ -2,31 +2,33 @@
 
 package random
 
+import "cmp"
+
 // mergeItem keeps track of a slice of data and what level the data is at.
 // it's different than a buffer because we want to be able to mutate the
 // slice, and the data is always sorted.
-type mergeItem struct {
-	data  []float64
+type mergeItem[T cmp.Ordered] struct {
+	data  []T
 	level int64
 }
 
 // mergeSorter merges the list of data slices in linear time.
-type mergeSorter struct {
-	items []mergeItem
+type mergeSorter[T cmp.Ordered] struct {
+	items []mergeItem[T]
 }
 
 // newMergeSorter constructs a mergeSorter from a list of buffers.
-func newMergeSorter(items []mergeItem) mergeSorter {
-	return mergeSorter{
+func newMergeSorter[T cmp.Ordered](items []mergeItem[T]) mergeSorter[T] {
+	return mergeSorter[T]{
 		items: items,
 	}
 }
 
 // next returns the minimum value from all the buffers and which buffer it
 // came from. it will return false if it ran out of values.
-func (m *mergeSorter) next() (val float64, level int64, ok bool) {
+func (m *mergeSorter[T]) next() (val T, level int64, ok bool) {
 	if len(m.items) == 0 {
-		return 0, 0, false
+		return val, 0, false
 	}
 
 	val, idx := m.items[0].data[0], 0
@@ -36,6 +38,7 @@ func (m *mergeSorter) next() (val float64, level int64, ok bool) {
 		}
 	}
 	item := &m.items[idx]
+	level = item.level
 
 	// if there's not enough values left in the item, swap the slice to the
 	// last position and slice it off so we never consider it again.
@@ -48,5 +51,5 @@ func (m *mergeSorter) next() (val float64, level int64, ok bool) {
 		item.data = item.data[1:]
 	}
 
-	return val, item.level, true
+	return val, level, true
 }
@@ -3,6 +3,7 @@
 package random
 
 import (
+	"math"
 	"math/rand"
 	"testing"
 )
@@ -36,3 +37,101 @@ func TestMerge_Normal(t *testing.T) {
 		t.Logf("%0.2f,%v,%v,%v", ptile, q_tot, q_mer, probit(ptile))
 	}
 }
+
+func TestMerge_Epsilons(t *testing.T) {
+	epss := []float64{0.05, 0.01, 0.001, 0.1, 0.005}
+
+	rs := make([]FinishedRandom, 0, len(epss))
+	for _, eps := range epss {
+		r := NewRandom(eps)
+		Seed(r, rand.NormFloat64)
+		rs = append(rs, r.Finish())
+	}
+	r_mer, err := Merge(uint64(rand.Int63()), rs[0], rs[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r_mer.E != 0.1 {
+		t.Fatalf("expected coarsest epsilon: %v", r_mer.E)
+	}
+	if err := r_mer.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	s_mer := r_mer.Summarize()
+	last := s_mer.Query(0)
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		query := s_mer.Query(ptile)
+		t.Logf("%0.2f,%v,%v", ptile, query, probit(ptile))
+		if query < last {
+			t.Fatalf("%v < %v", query, last)
+		}
+		last = query
+	}
+	t.Logf("err:%v", L1Norm(s_mer, probit))
+
+	if _, err := Merge(0, rs[0], FinishedRandom{E: 1}); err == nil {
+		t.Fatalf("expected error merging bad epsilon")
+	}
+}
+
+// totalWeight returns the number of observations represented by the values in
+// the buffers.
+func totalWeight(f FinishedRandom) (total int64) {
+	for _, buf := range f.Buffers {
+		total += int64(len(buf.Data)) << uint(buf.Level)
+	}
+	return total
+}
+
+func TestMerge_Partial(t *testing.T) {
+	for _, eps := range []float64{0.1, 0.05, 0.01, 0.001} {
+		for _, size := range []int{1, 10, 1000, 12345} {
+			rs := make([]FinishedRandom, 0)
+			for i := 0; i < 10; i++ {
+				r := NewRandom(eps)
+				for j := 0; j < size; j++ {
+					r.Add(rand.NormFloat64())
+				}
+				rs = append(rs, r.Finish())
+			}
+			r_mer, err := Merge(uint64(rand.Int63()), rs[0], rs[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r_mer.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the buffers should still account for all of the observations,
+			// give or take the values lost when halving odd sized buffers.
+			total := totalWeight(r_mer)
+			diff := math.Abs(float64(total - r_mer.N))
+			t.Logf("eps:%v size:%d n:%d total:%d", eps, size, r_mer.N, total)
+			if diff > eps*float64(r_mer.N) {
+				t.Fatalf("total %d too far from %d", total, r_mer.N)
+			}
+		}
+	}
+}
+
+func TestMerge_Empty(t *testing.T) {
+	r := NewRandom(0.1)
+	r.Add(5)
+	empty := FinishedRandom{E: 0.1}
+
+	// the zero extremes of a hand built empty input must not be used.
+	for _, f := range []struct{ a, b FinishedRandom }{
+		{r.Finish(), empty},
+		{empty, r.Finish()},
+	} {
+		m, err := Merge(0, f.a, f.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := m.Summarize()
+		if m.Min != 5 || m.Max != 5 || s.Query(0) != 5 || s.Query(1) != 5 {
+			t.Fatalf("bad extremes: %v %v", m.Min, m.Max)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"errors"
+	"math"
+)
+
+// NaNPolicy controls what a Random does with NaN values, which have no place
+// in the ordering of the values and so can't be summarized.
+type NaNPolicy int
+
+const (
+	// DropNaN drops NaN values, counting them in the NaNs field of the
+	// FinishedRandom. It is the default policy.
+	DropNaN NaNPolicy = iota
+
+	// RejectNaN causes TryAdd to return ErrNaN for NaN values without
+	// recording them at all. Methods that can't return an error drop and
+	// count them as with DropNaN.
+	RejectNaN
+
+	// NaNAsInf records NaN values as +Inf, or -Inf if their sign bit is set,
+	// counting them in both the NaNs and Infs fields of the FinishedRandom.
+	NaNAsInf
+)
+
+// ErrNaN is returned by TryAdd for NaN values when the policy is RejectNaN.
+var ErrNaN = errors.New("NaN value rejected")
+
+// SetNaNPolicy sets the policy for handling NaN values passed to Add.
+func (r *RandomOf[T]) SetNaNPolicy(policy NaNPolicy) {
+	r.policy = policy
+}
+
+// TryAdd is like Add but returns ErrNaN without recording the value if it is
+// NaN and the policy is RejectNaN.
+func (r *RandomOf[T]) TryAdd(value T) error {
+	if r.policy == RejectNaN && value != value {
+		return ErrNaN
+	}
+	r.Add(value)
+	return nil
+}
+
+// isSpecial returns true if the value is NaN or infinite. it is cheap enough
+// to check on every value so that only those values pay for special, and it is
+// always false for integer types.
+func isSpecial[T Value](value T) bool {
+	return value-value != 0
+}
+
+// special counts weight occurrences of a NaN or infinite value, returning the
+// value that should be added in its place and false if it should be dropped.
+func (r *RandomOf[T]) special(value T, weight int64) (T, bool) {
+	if value != value {
+		r.nans += weight
+		if r.policy != NaNAsInf {
+			return value, false
+		}
+		lo, hi := extremes[T]()
+		if math.Signbit(float64(value)) {
+			value = lo
+		} else {
+			value = hi
+		}
+	}
+	r.infs += weight
+	return value, true
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// openMetricsContentType is the content type of the OpenMetrics format.
+const openMetricsContentType = "application/openmetrics-text; " +
+	"version=1.0.0; charset=utf-8"
+
+// acceptsOpenMetrics reports whether the Accept header of a request prefers
+// the OpenMetrics format, version 1.0.0, to the Prometheus text format. It
+// compares the highest q of the media ranges for each, where text/plain and
+// */* match the text format, and picks OpenMetrics when they tie. OpenMetrics
+// must be asked for by name, so a missing header gets the text format.
+func acceptsOpenMetrics(accept string) bool {
+	openMetrics, text := 0.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		media, params, _ := strings.Cut(part, ";")
+		q, version := mediaParams(params)
+
+		switch strings.ToLower(strings.TrimSpace(media)) {
+		case "application/openmetrics-text":
+			if (version == "" || version == "1.0.0") && q > openMetrics {
+				openMetrics = q
+			}
+		case "text/plain", "text/*", "*/*":
+			if q > text {
+				text = q
+			}
+		}
+	}
+	return openMetrics > 0 && openMetrics >= text
+}
+
+// mediaParams returns the q and version parameters of a media range in an
+// Accept header. The q is 1 if it is missing, and 0 if it is invalid so that
+// the media range is not acceptable.
+func mediaParams(params string) (q float64, version string) {
+	q = 1
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		switch {
+		case strings.EqualFold(key, "q"):
+			var err error
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+		case strings.EqualFold(key, "version"):
+			version = strings.Trim(value, `"`)
+		}
+	}
+	return q, version
+}
+
+// WriteOpenMetrics writes the Summary as the Metric in the OpenMetrics format,
+// version 1.0.0, including the unit, the created series and the terminating
+// "# EOF" line. It returns an error if the Metric is invalid or the write
+// fails.
+func (m Metric) WriteOpenMetrics(w io.Writer, s Summary) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	m.appendHeader(&buf, expositionOpenMetrics)
+	m.appendSamples(&buf, s, expositionOpenMetrics)
+	buf.WriteString("# EOF\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteOpenMetrics writes every registered sketch in the OpenMetrics format,
+// version 1.0.0, grouped by name in sorted order and followed by the
+// terminating "# EOF" line.
+func (r *Registry) WriteOpenMetrics(w io.Writer) error {
+	return r.write(w, expositionOpenMetrics)
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"bytes"
+	"flag"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares the output with the golden file of the given name,
+// rewriting the file instead if -update is passed.
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, exp) {
+		t.Fatalf("%s mismatch. got:\n%s\nexpected:\n%s", name, got, exp)
+	}
+}
+
+// goldenRegistry returns a Registry with sketches that have exact answers, so
+// that its output is always the same.
+func goldenRegistry(t *testing.T) *Registry {
+	durations := NewConcurrentRandomWithSeed(0.01, 1, 0)
+	for i := 1; i <= 100; i++ {
+		durations.Add(float64(i) / 1000)
+	}
+	sizes := NewConcurrentRandomWithSeed(0.01, 1, 0)
+	for i := 0; i < 10; i++ {
+		sizes.Add(float64(int64(1) << uint(i*4)))
+	}
+
+	reg := NewRegistry()
+	for _, entry := range []struct {
+		m Metric
+		c *ConcurrentRandom
+	}{
+		{Metric{
+			Name:    "request_duration_seconds",
+			Help:    "How long \"requests\" take.\nIncluding \\ queueing.",
+			Unit:    "seconds",
+			Labels:  map[string]string{"method": "GET", "path": "/"},
+			Created: time.Unix(1500000000, 250000000),
+		}, durations},
+		{Metric{
+			Name:    "request_duration_seconds",
+			Help:    "How long \"requests\" take.\nIncluding \\ queueing.",
+			Unit:    "seconds",
+			Labels:  map[string]string{"method": "POST", "path": "/\"x\""},
+			Created: time.Unix(1500000000, 0),
+		}, NewConcurrentRandomWithSeed(0.01, 1, 0)},
+		{Metric{
+			Name:      "response_size_bytes",
+			Unit:      "bytes",
+			Quantiles: []float64{0, 0.25, 0.75, 1},
+		}, sizes},
+	} {
+		if err := reg.Register(entry.m, entry.c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+func TestOpenMetrics_Golden(t *testing.T) {
+	reg := goldenRegistry(t)
+
+	var buf bytes.Buffer
+	if err := reg.WriteOpenMetrics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "openmetrics.golden", buf.Bytes())
+
+	buf.Reset()
+	if err := reg.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "prometheus.golden", buf.Bytes())
+}
+
+func TestOpenMetrics_Negotiation(t *testing.T) {
+	reg := goldenRegistry(t)
+
+	cases := []struct {
+		accept      string
+		contentType string
+	}{
+		{"", prometheusContentType},
+		{"text/plain", prometheusContentType},
+		{"application/openmetrics-text", openMetricsContentType},
+
+		// what Prometheus sends when it prefers OpenMetrics.
+		{"application/openmetrics-text;version=1.0.0," +
+			"application/openmetrics-text;version=0.0.1;q=0.75," +
+			"text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			openMetricsContentType},
+
+		// media ranges with a q of 0 are not acceptable.
+		{"application/openmetrics-text;q=0, text/plain", prometheusContentType},
+		{"application/openmetrics-text; Q=0.0", prometheusContentType},
+		{"application/openmetrics-text;q=0.1", openMetricsContentType},
+
+		// the format with the highest q wins, and OpenMetrics wins ties.
+		{"text/plain;q=1, application/openmetrics-text;q=0.1",
+			prometheusContentType},
+		{"*/*;q=0.8, application/openmetrics-text;q=0.5",
+			prometheusContentType},
+		{"text/plain;q=0.5, application/openmetrics-text;q=0.5",
+			openMetricsContentType},
+		{"application/openmetrics-text;q=0.9, text/plain;q=0.5",
+			openMetricsContentType},
+		{"*/*", prometheusContentType},
+
+		// only version 1.0.0 of OpenMetrics is written.
+		{"application/openmetrics-text;version=0.0.1", prometheusContentType},
+		{"application/openmetrics-text;version=0.0.1, text/plain;q=0.1",
+			prometheusContentType},
+		{"application/openmetrics-text; version=\"1.0.0\"",
+			openMetricsContentType},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, req)
+
+		if ct := rec.Header().Get("Content-Type"); ct != c.contentType {
+			t.Fatalf("%q: bad content type %q", c.accept, ct)
+		}
+		eof := strings.HasSuffix(rec.Body.String(), "# EOF\n")
+		if eof != (c.contentType == openMetricsContentType) {
+			t.Fatalf("%q: unexpected body:\n%s", c.accept, rec.Body)
+		}
+	}
+}
+
+func TestOpenMetrics_Metric(t *testing.T) {
+	var buf bytes.Buffer
+	m := Metric{Name: "a_seconds", Unit: "seconds", Quantiles: []float64{}}
+	if err := m.WriteOpenMetrics(&buf, Summary{}); err != nil {
+		t.Fatal(err)
+	}
+	exp := "# TYPE a_seconds summary\n# UNIT a_seconds seconds\n" +
+		"a_seconds_sum 0\na_seconds_count 0\n# EOF\n"
+	if got := buf.String(); got != exp {
+		t.Fatalf("got:\n%s\nexpected:\n%s", got, exp)
+	}
+
+	m = Metric{Name: "a_seconds", Unit: "bytes"}
+	if err := m.WriteOpenMetrics(&buf, Summary{}); err == nil {
+		t.Fatalf("expected error for unit not in the name")
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	cases := map[string]time.Time{
+		"0":             time.Unix(0, 0),
+		"1500000000.25": time.Unix(1500000000, 250000000),
+		"-1.5":          time.Unix(-2, 500000000),
+		"0.000000001":   time.Unix(0, 1),
+	}
+	for exp, ts := range cases {
+		if got := formatTimestamp(ts); got != exp {
+			t.Fatalf("%v: %q != %q", ts, got, exp)
+		}
+	}
+}
@@ -49,6 +49,11 @@ func (p *pcg) Uint32() uint32 {
 	return xorshifted>>rot | (xorshifted << ((-rot) & 31))
 }
 
+// Uint64 returns a random uint64, such as to seed another generator.
+func (p *pcg) Uint64() uint64 {
+	return uint64(p.Uint32())<<32 | uint64(p.Uint32())
+}
+
 // Intn returns an int uniformly in [0, n)
 func (p *pcg) Intn(n int) int {
 	return fastMod(p.Uint32(), n)
@@ -0,0 +1,330 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusContentType is the content type of the Prometheus text format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// exposition is a format that metrics can be written in.
+type exposition int
+
+const (
+	expositionPrometheus exposition = iota
+	expositionOpenMetrics
+)
+
+// DefaultQuantiles are the quantiles exposed for a Metric that doesn't set
+// any.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Metric describes how a Summary is exposed as a Prometheus summary metric.
+type Metric struct {
+	// Name is the name of the metric, like "request_duration_seconds".
+	Name string
+
+	// Help is the optional help text of the metric.
+	Help string
+
+	// Unit is the optional unit of the metric, like "seconds", which the
+	// name must end with after an underscore. It is only written in the
+	// OpenMetrics format.
+	Unit string
+
+	// Labels are the labels of the metric, which may not include "quantile".
+	Labels map[string]string
+
+	// Quantiles are the quantiles to expose, each within [0, 1]. If nil,
+	// DefaultQuantiles are used.
+	Quantiles []float64
+
+	// Created is the optional time the sketch started observing values. It
+	// is only written in the OpenMetrics format, as the _created series.
+	Created time.Time
+}
+
+// validate checks that the Metric can be written in the Prometheus text and
+// OpenMetrics formats.
+func (m Metric) validate() error {
+	if !validMetricName(m.Name) {
+		return fmt.Errorf("bad metric: invalid name %q", m.Name)
+	}
+	if m.Unit != "" && (!validLabelName(m.Unit) ||
+		!strings.HasSuffix(m.Name, "_"+m.Unit)) {
+		return fmt.Errorf("bad metric: invalid unit %q for name %q",
+			m.Unit, m.Name)
+	}
+	for name := range m.Labels {
+		if !validLabelName(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("bad metric: invalid label name %q", name)
+		}
+		if name == "quantile" {
+			return fmt.Errorf("bad metric: reserved label name %q", name)
+		}
+	}
+	for _, q := range m.Quantiles {
+		if !(q >= 0 && q <= 1) {
+			return fmt.Errorf("bad metric: quantile %v out of range", q)
+		}
+	}
+	return nil
+}
+
+// validMetricName reports whether the name matches [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validMetricName(name string) bool {
+	for i, c := range name {
+		switch {
+		case c == '_' || c == ':',
+			c >= 'a' && c <= 'z',
+			c >= 'A' && c <= 'Z',
+			c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// validLabelName reports whether the name matches [a-zA-Z_][a-zA-Z0-9_]*.
+func validLabelName(name string) bool {
+	return validMetricName(name) && !strings.Contains(name, ":")
+}
+
+// WritePrometheus writes the Summary as the Metric in the Prometheus text
+// format, version 0.0.4. It returns an error if the Metric is invalid or the
+// write fails.
+func (m Metric) WritePrometheus(w io.Writer, s Summary) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	m.appendHeader(&buf, expositionPrometheus)
+	m.appendSamples(&buf, s, expositionPrometheus)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// appendHeader appends the metadata lines for the metric.
+func (m Metric) appendHeader(buf *bytes.Buffer, e exposition) {
+	if m.Help != "" {
+		fmt.Fprintf(buf, "# HELP %s %s\n", m.Name, escapeHelp(m.Help, e))
+	}
+	fmt.Fprintf(buf, "# TYPE %s summary\n", m.Name)
+	if m.Unit != "" && e == expositionOpenMetrics {
+		fmt.Fprintf(buf, "# UNIT %s %s\n", m.Name, m.Unit)
+	}
+}
+
+// appendSamples appends the quantile, sum and count lines for the Summary, and
+// the created line if there is one for the OpenMetrics format.
+func (m Metric) appendSamples(buf *bytes.Buffer, s Summary, e exposition) {
+	quantiles := m.Quantiles
+	if quantiles == nil {
+		quantiles = DefaultQuantiles
+	}
+
+	labels := m.formatLabels()
+	for _, q := range quantiles {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		fmt.Fprintf(buf, "%s{%s%squantile=\"%s\"} %s\n", m.Name, labels, sep,
+			formatFloat(q), formatFloat(s.Query(q)))
+	}
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(buf, "%s_sum%s %s\n", m.Name, labels, formatFloat(s.Sum()))
+	fmt.Fprintf(buf, "%s_count%s %d\n", m.Name, labels, s.Count())
+	if !m.Created.IsZero() && e == expositionOpenMetrics {
+		fmt.Fprintf(buf, "%s_created%s %s\n", m.Name, labels,
+			formatTimestamp(m.Created))
+	}
+}
+
+// formatLabels returns the labels sorted by name and separated by commas,
+// without the surrounding braces.
+func (m Metric) formatLabels() string {
+	names := make([]string, 0, len(m.Labels))
+	for name := range m.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", name, escapeLabelValue(m.Labels[name]))
+	}
+	return b.String()
+}
+
+// formatFloat formats the value as Prometheus expects.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// formatTimestamp formats the time as seconds since the unix epoch.
+func formatTimestamp(t time.Time) string {
+	sign, nanos := "", t.UnixNano()
+	if nanos < 0 {
+		sign, nanos = "-", -nanos
+	}
+	sec, frac := nanos/1e9, nanos%1e9
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, sec)
+	}
+	return strings.TrimRight(fmt.Sprintf("%s%d.%09d", sign, sec, frac), "0")
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and newlines in help text, and double quotes
+// too for the OpenMetrics format.
+func escapeHelp(help string, e exposition) string {
+	if e == expositionOpenMetrics {
+		return labelValueEscaper.Replace(help)
+	}
+	return helpEscaper.Replace(help)
+}
+
+// escapeLabelValue escapes backslashes, newlines and double quotes in a label
+// value.
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// Registry is a set of named sketches that can be written in the Prometheus
+// text or OpenMetrics formats. It is an http.Handler that serves them. It is
+// safe to use from many goroutines at once.
+type Registry struct {
+	mu      sync.Mutex
+	entries []registryEntry
+}
+
+// registryEntry is a sketch and how to expose it.
+type registryEntry struct {
+	metric Metric
+	labels string // the formatted labels to check for duplicates
+	s      func() Summary
+}
+
+// NewRegistry constructs an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds the sketch to the Registry to be exposed as the Metric. Many
+// sketches may share a name if they have different labels and the same help
+// text and unit. It returns an error if the Metric is invalid or conflicts
+// with one already registered.
+func (r *Registry) Register(m Metric, c *ConcurrentRandom) error {
+	return r.RegisterFunc(m, c.Summarize)
+}
+
+// RegisterFunc is like Register but exposes the Summary returned by the
+// function. The function may be called at any time from any goroutine, so it
+// must do its own locking, such as around a Random that is still being added
+// to. The _sum and _count of a summary metric are counters that must never go
+// down, so it should not summarize a WindowedRandom or DecayingRandom.
+func (r *Registry) RegisterFunc(m Metric, summarize func() Summary) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+	labels := m.formatLabels()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.entries {
+		if entry.metric.Name != m.Name {
+			continue
+		}
+		if entry.labels == labels {
+			return fmt.Errorf("bad metric: %s{%s} already registered",
+				m.Name, labels)
+		}
+		if entry.metric.Help != m.Help || entry.metric.Unit != m.Unit {
+			return fmt.Errorf("bad metric: %s registered with other help "+
+				"or unit", m.Name)
+		}
+	}
+
+	r.entries = append(r.entries, registryEntry{
+		metric: m,
+		labels: labels,
+		s:      summarize,
+	})
+	return nil
+}
+
+// WritePrometheus writes every registered sketch in the Prometheus text
+// format, version 0.0.4, grouped by name in sorted order.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	return r.write(w, expositionPrometheus)
+}
+
+// write writes every registered sketch in the format.
+func (r *Registry) write(w io.Writer, e exposition) error {
+	r.mu.Lock()
+	entries := append([]registryEntry(nil), r.entries...)
+	r.mu.Unlock()
+
+	// the registration order is kept for sketches with the same name.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].metric.Name < entries[j].metric.Name
+	})
+
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i == 0 || entries[i-1].metric.Name != entry.metric.Name {
+			entry.metric.appendHeader(&buf, e)
+		}
+		entry.metric.appendSamples(&buf, entry.s(), e)
+	}
+	if e == expositionOpenMetrics {
+		buf.WriteString("# EOF\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ServeHTTP implements http.Handler by writing every registered sketch in the
+// OpenMetrics format if the Accept header prefers it, and in the Prometheus
+// text format otherwise.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if acceptsOpenMetrics(req.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", openMetricsContentType)
+		r.WriteOpenMetrics(w)
+		return
+	}
+	w.Header().Set("Content-Type", prometheusContentType)
+	r.WritePrometheus(w)
+}
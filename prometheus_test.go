@@ -0,0 +1,150 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrometheus_Metric(t *testing.T) {
+	// few enough values that they are all kept, so the quantiles are exact.
+	r := NewRandom(0.01)
+	for i := 1; i <= 100; i++ {
+		r.Add(float64(i))
+	}
+
+	m := Metric{
+		Name:      "request_duration_seconds",
+		Help:      "How long requests take.\nIn seconds, with a \\.",
+		Labels:    map[string]string{"method": "GET", "path": "/a\"b\"\n"},
+		Quantiles: []float64{0, 0.5, 0.99, 1},
+	}
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf, r.Summarize()); err != nil {
+		t.Fatal(err)
+	}
+
+	exp := `# HELP request_duration_seconds How long requests take.\nIn seconds, with a \\.
+# TYPE request_duration_seconds summary
+request_duration_seconds{method="GET",path="/a\"b\"\n",quantile="0"} 1
+request_duration_seconds{method="GET",path="/a\"b\"\n",quantile="0.5"} 51
+request_duration_seconds{method="GET",path="/a\"b\"\n",quantile="0.99"} 100
+request_duration_seconds{method="GET",path="/a\"b\"\n",quantile="1"} 100
+request_duration_seconds_sum{method="GET",path="/a\"b\"\n"} 5050
+request_duration_seconds_count{method="GET",path="/a\"b\"\n"} 100
+`
+	if got := buf.String(); got != exp {
+		t.Fatalf("got:\n%s\nexpected:\n%s", got, exp)
+	}
+
+	// an empty summary has NaN quantiles and no labels means no braces.
+	buf.Reset()
+	m = Metric{Name: "empty", Quantiles: []float64{0.5}}
+	if err := m.WritePrometheus(&buf, NewRandom(0.1).Summarize()); err != nil {
+		t.Fatal(err)
+	}
+	exp = `# TYPE empty summary
+empty{quantile="0.5"} NaN
+empty_sum 0
+empty_count 0
+`
+	if got := buf.String(); got != exp {
+		t.Fatalf("got:\n%s\nexpected:\n%s", got, exp)
+	}
+}
+
+func TestPrometheus_Invalid(t *testing.T) {
+	cases := map[string]Metric{
+		"empty name":   {},
+		"name":         {Name: "0abc"},
+		"name char":    {Name: "a-b"},
+		"label":        {Name: "a", Labels: map[string]string{"a:b": ""}},
+		"reserved":     {Name: "a", Labels: map[string]string{"__a": ""}},
+		"quantile":     {Name: "a", Labels: map[string]string{"quantile": ""}},
+		"out of range": {Name: "a", Quantiles: []float64{1.5}},
+	}
+	for name, m := range cases {
+		if err := m.WritePrometheus(io.Discard, Summary{}); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else {
+			t.Logf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestPrometheus_Registry(t *testing.T) {
+	reg := NewRegistry()
+	add := func(m Metric, values ...float64) error {
+		r := NewConcurrentRandom(0.01, 1)
+		for _, value := range values {
+			r.Add(value)
+		}
+		return reg.Register(m, r)
+	}
+
+	for _, err := range []error{
+		add(Metric{Name: "b", Help: "B.", Labels: map[string]string{"x": "1"}}, 1),
+		add(Metric{Name: "a", Quantiles: []float64{0.5}}, 2, 3),
+		add(Metric{Name: "b", Help: "B.", Labels: map[string]string{"x": "2"}}, 4),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := add(Metric{Name: "b", Help: "B.", Labels: map[string]string{"x": "1"}}); err == nil {
+		t.Fatalf("expected duplicate error")
+	}
+	if err := add(Metric{Name: "b", Help: "C.", Labels: map[string]string{"x": "3"}}); err == nil {
+		t.Fatalf("expected help mismatch error")
+	}
+
+	var mu sync.Mutex
+	r := NewRandom(0.01)
+	r.Add(5)
+	if err := reg.RegisterFunc(Metric{Name: "c"}, func() Summary {
+		mu.Lock()
+		defer mu.Unlock()
+		return r.Summarize()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Fatalf("bad content type: %q", ct)
+	}
+
+	exp := strings.Join([]string{
+		`# TYPE a summary`,
+		`a{quantile="0.5"} 3`,
+		`a_sum 5`,
+		`a_count 2`,
+		`# HELP b B.`,
+		`# TYPE b summary`,
+		`b{x="1",quantile="0.5"} 1`,
+		`b{x="1",quantile="0.9"} 1`,
+		`b{x="1",quantile="0.99"} 1`,
+		`b_sum{x="1"} 1`,
+		`b_count{x="1"} 1`,
+		`b{x="2",quantile="0.5"} 4`,
+		`b{x="2",quantile="0.9"} 4`,
+		`b{x="2",quantile="0.99"} 4`,
+		`b_sum{x="2"} 4`,
+		`b_count{x="2"} 1`,
+		`# TYPE c summary`,
+		`c{quantile="0.5"} 5`,
+		`c{quantile="0.9"} 5`,
+		`c{quantile="0.99"} 5`,
+		`c_sum 5`,
+		`c_count 1`,
+	}, "\n") + "\n"
+	if got := rec.Body.String(); got != exp {
+		t.Fatalf("got:\n%s\nexpected:\n%s", got, exp)
+	}
+}
@@ -3,8 +3,12 @@
 package random
 
 import (
+	"cmp"
+	"fmt"
 	"math"
 	"math/rand"
+	"slices"
+	"unsafe"
 )
 
 // paramsFromEps returns the parameters used for the random quantile estimator
@@ -15,6 +19,30 @@ func paramsFromEps(eps float64) (b, s int) {
 	return b, s
 }
 
+// maxBlockSize is the most values that the buffers for an epsilon may hold.
+// it keeps tiny epsilons from overflowing the parameters, and decoding from
+// trusting an epsilon that no Random could have been constructed with.
+const maxBlockSize = 1 << 32
+
+// validEps reports whether the epsilon is within (0, 1) and its buffers hold
+// at most maxBlockSize values.
+func validEps(eps float64) bool {
+	if !(eps > 0 && eps < 1) {
+		return false
+	}
+	// compute the size in floating point so that it can't overflow.
+	lg := -math.Log2(eps)
+	return (math.Ceil(lg)+1)*math.Ceil(math.Sqrt(lg)/eps) <= maxBlockSize
+}
+
+// mustValidEps panics if the epsilon is not valid. It is for the constructors
+// of sketches that merge Randoms and can't return an error.
+func mustValidEps(eps float64) {
+	if !validEps(eps) {
+		panic(fmt.Sprintf("bad epsilon: %v", eps))
+	}
+}
+
 // blockSize returns the allocation size of the number of floats for a given
 // epsilon.
 func blockSize(eps float64) int {
@@ -22,32 +50,48 @@ func blockSize(eps float64) int {
 	return b * s
 }
 
+// memoryUsage returns the number of bytes a Random with the given epsilon
+// uses, including the buffers, their headers and the merger scratch space.
+func memoryUsage(eps float64) int {
+	b, s := paramsFromEps(eps)
+	return int(unsafe.Sizeof(Random{})) +
+		int(unsafe.Sizeof(bufferMerger[float64]{})) +
+		b*int(unsafe.Sizeof(Buffer{})) +
+		(b*s+s)*int(unsafe.Sizeof(float64(0)))
+}
+
 // EstimateEpsilon finds an epsilon within tol of the epsilon that would return
 // the largest number of floats NewRandom would use under the specified floats.
 func EstimateEpsilon(floats int, tol float64) float64 {
 	// search for an eps such that floats ==
 	//	(math.Ceil(-math.Log2(eps)) + 1) *
 	//	math.Ceil(math.Sqrt(-math.Log2(eps))/eps)
+	return searchEpsilon(floats, tol, blockSize)
+}
 
+// searchEpsilon finds an epsilon within tol of the epsilon with the largest
+// size under the limit, where size is decreasing in epsilon. It returns 1 if
+// there is no such epsilon.
+func searchEpsilon(limit int, tol float64, size func(float64) int) float64 {
 	min, max := 1.0, 0.0 // the function is decreasing
 	min_size, max_size := -1, -1
 	for {
 		guess := (min + max) / 2
-		guess_size := blockSize(guess)
+		guess_size := size(guess)
 		switch {
-		case guess_size == floats:
+		case guess_size == limit:
 			// how lucky
 			return guess
-		case guess_size < floats:
+		case guess_size < limit:
 			// we guessed too low, so set the new minimum to our guess.
 			min, min_size = guess, guess_size
-		case guess_size > floats:
+		case guess_size > limit:
 			// we guessed too high, so set the new maximum to our guess
 			max, max_size = guess, guess_size
 		}
 		// if there's no way for us to make progress or we're within the given
 		// tolerance, just bail now and return the smaller min value, because
-		// min is guaranteed to cause a size less than floats as it only gets
+		// min is guaranteed to cause a size less than limit as it only gets
 		// set when that is the case.
 		if min_size == max_size || min-max < tol {
 			return min
@@ -55,17 +99,17 @@ func EstimateEpsilon(floats int, tol float64) float64 {
 	}
 }
 
-// Random implements the random quantile estimator. The expected usage is to
-// create one, Add the points as desired, and then call Finish and never use
-// the Random again. It would be unsafe to do anything else.
-type Random struct {
+// sampler is the part of the random quantile estimator that samples values
+// into the buffers, merging them as they fill up. it only needs the values to
+// be ordered, so that it can be shared by RandomOf and KeyRandom.
+type sampler[T cmp.Ordered] struct {
 	e float64 // epsilon
 	b int     // -log(e) + 1
 	s int     // sqrt(-log(e)) / e
 
-	buffers []Buffer
-	merger  *bufferMerger
-	cur     *Buffer // the current buffer we're filling in
+	buffers []BufferOf[T]
+	merger  *bufferMerger[T]
+	cur     *BufferOf[T] // the current buffer we're filling in
 
 	// these values keep track of how many elements we've observed in the
 	// current buffer. we only add one element per 1 << level observations.
@@ -74,10 +118,10 @@ type Random struct {
 	// in the ordering of the data. for example, if we had two servers reporting
 	// the values that pass might be in the order of A B A B, and so we'd always
 	// sample values from A or B. it is chosen's job to avoid that problem.
-	count     int     // the number of elements we still need to observe
-	chosen    int     // prechoose the value since we know the level
-	pcg       pcg     // used to reservoir sample
-	reservoir float64 // the current element in the reservoir
+	count     int // the number of elements we still need to observe
+	chosen    int // prechoose the value since we know the level
+	pcg       pcg // used to reservoir sample
+	reservoir T   // the current element in the reservoir
 
 	// level contains what level we're currently filling. it gets set when
 	// we choose a new bucket to fill based on the current value of n.
@@ -89,56 +133,207 @@ type Random struct {
 	n    int64
 }
 
-// NewRandom calls NewRandomWithSeed with a random seed from math/rand.
-func NewRandom(eps float64) *Random {
-	return NewRandomWithSeed(eps, uint64(rand.Int63()))
-}
-
-// NewRandomWithSeed constructs a Random with the given epsilon tolerance for
-// changes in the CDF. The seed parameter lets one choose what seed to use for
-// the collection of the stream.
-func NewRandomWithSeed(eps float64, seed uint64) *Random {
+// newSampler constructs a sampler with the given epsilon. it must be reset
+// before it is used.
+func newSampler[T cmp.Ordered](eps float64) sampler[T] {
 	b, s := paramsFromEps(eps)
 
 	// allocate all the space for the buffers in one allocation and dole them
 	// out to each buffer
-	block := make([]float64, b*s)
+	block := make([]T, b*s)
 
-	buffers := make([]Buffer, b)
+	buffers := make([]BufferOf[T], b)
 	for i := range buffers {
 		start := int(s) * i
 		end := start + int(s)
 		buffers[i] = newBuffer(block[start:end:end])
 	}
-	buf := &buffers[0]
-	buf.Level = 0
 
-	return &Random{
+	return sampler[T]{
 		e: eps,
 		b: b,
 		s: s,
 
 		buffers: buffers,
-		merger:  newBufferMerger(make([]float64, s), newPCG(seed, 0)),
-		cur:     buf,
+		merger:  newBufferMerger(make([]T, s), pcg{}),
+	}
+}
+
+// reset returns the sampler to the state it was in when it was constructed,
+// but with the given seed.
+func (r *sampler[T]) reset(seed uint64) {
+	for i := range r.buffers {
+		r.buffers[i].clear()
+	}
+	r.cur = &r.buffers[0]
+	r.cur.Level = 0
+	r.merger.coin = coin{pcg: newPCG(seed, 0)}
+
+	var zero T
+	r.count = 0
+	r.chosen = 1
+	r.pcg = newPCG(seed, 1)
+	r.reservoir = zero
+
+	r.level = 0
+	r.next = int64(r.s) * 1 << uint(r.b-1)
+	r.n = 0
+}
+
+// RandomOf implements the random quantile estimator for values of type T. The
+// expected usage is to create one, Add the points as desired, and then call
+// Finish and never use the RandomOf again. It would be unsafe to do anything
+// else, except for calling Snapshot, which can be done at any time.
+type RandomOf[T Value] struct {
+	sampler[T]
+
+	// these values keep track of the exact extremes and sum of everything
+	// observed, since the buffers only hold a sample.
+	min T
+	max T
+	sum float64
+
+	// policy is what to do with NaN values, and nans and infs count how many
+	// NaN and infinite values were observed.
+	policy NaNPolicy
+	nans   int64
+	infs   int64
+}
+
+// Random is a RandomOf float64 values.
+type Random = RandomOf[float64]
+
+// NewRandom calls NewRandomWithSeed with a random seed from math/rand.
+func NewRandom(eps float64) *Random {
+	return NewRandomWithSeed(eps, uint64(rand.Int63()))
+}
+
+// NewRandomWithSeed constructs a Random with the given epsilon tolerance for
+// changes in the CDF. The seed parameter lets one choose what seed to use for
+// the collection of the stream.
+func NewRandomWithSeed(eps float64, seed uint64) *Random {
+	return NewRandomOfWithSeed[float64](eps, seed)
+}
+
+// NewRandomOf calls NewRandomOfWithSeed with a random seed from math/rand.
+func NewRandomOf[T Value](eps float64) *RandomOf[T] {
+	return NewRandomOfWithSeed[T](eps, uint64(rand.Int63()))
+}
 
-		count:  0,
-		chosen: 1,
-		pcg:    newPCG(seed, 1),
+// NewRandomOfWithSeed is like NewRandomWithSeed but constructs a RandomOf for
+// values of type T.
+func NewRandomOfWithSeed[T Value](eps float64, seed uint64) *RandomOf[T] {
+	r := &RandomOf[T]{sampler: newSampler[T](eps)}
+	r.Reset(seed)
+	return r
+}
 
-		next: int64(s) * 1 << uint(b-1),
+// Reset returns the Random to the state it was in when it was constructed,
+// but with the given seed, reusing all of its memory. The NaN policy is kept.
+// A FinishedRandom returned by Finish shares memory with the Random, so it
+// must no longer be in use when Reset is called. This makes it possible to
+// keep Randoms in a sync.Pool:
+//
+//	r := pool.Get().(*random.Random)
+//	r.Reset(seed)
+//	// ... call r.Add ...
+//	f := r.Finish()
+//	// ... summarize, merge or encode f, and stop using it ...
+//	pool.Put(r)
+func (r *RandomOf[T]) Reset(seed uint64) {
+	r.reset(seed)
+
+	r.max, r.min = extremes[T]()
+	r.sum = 0
+
+	r.nans = 0
+	r.infs = 0
+}
+
+// observe updates the exact statistics with the value.
+func (r *RandomOf[T]) observe(value T) {
+	if value < r.min {
+		r.min = value
+	}
+	if value > r.max {
+		r.max = value
 	}
 }
 
+// Option configures a Random constructed by NewRandomWithBudget.
+type Option func(*options)
+
+// options holds the values configured by Options.
+type options struct {
+	seed   uint64
+	policy NaNPolicy
+}
+
+// WithSeed sets the seed used for the collection of the stream. By default a
+// random seed from math/rand is used.
+func WithSeed(seed uint64) Option {
+	return func(o *options) { o.seed = seed }
+}
+
+// WithNaNPolicy sets the policy for handling NaN values. By default they are
+// dropped.
+func WithNaNPolicy(policy NaNPolicy) Option {
+	return func(o *options) { o.policy = policy }
+}
+
+// budgetTolerance is the tolerance NewRandomWithBudget searches for an epsilon
+// with.
+const budgetTolerance = 1e-9
+
+// NewRandomWithBudget constructs a Random with the smallest epsilon that keeps
+// the memory it uses within the given number of bytes. It returns an error if
+// the budget is too small for any epsilon. The chosen epsilon is available
+// from the Epsilon method.
+func NewRandomWithBudget(bytes int, opts ...Option) (*Random, error) {
+	o := options{seed: uint64(rand.Int63())}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	eps := searchEpsilon(bytes, budgetTolerance, memoryUsage)
+	if eps >= 1 || memoryUsage(eps) > bytes {
+		return nil, fmt.Errorf("budget of %d bytes too small: need %d",
+			bytes, memoryUsage(math.Nextafter(1, 0)))
+	}
+
+	r := NewRandomWithSeed(eps, o.seed)
+	r.SetNaNPolicy(o.policy)
+	return r, nil
+}
+
+// Epsilon returns the epsilon the Random was constructed with.
+func (r *RandomOf[T]) Epsilon() float64 {
+	return r.e
+}
+
 // resetCount resets the counter of observed values for this bucket entry to
 // zero and picks the index that we'll pick for the next value.
-func (r *Random) resetCount() {
+func (r *sampler[T]) resetCount() {
 	r.count = 0
 	r.chosen = r.pcg.Intn(1<<r.level) + 1
 }
 
 // Add puts the value in the quantile estimator.
-func (r *Random) Add(value float64) {
+func (r *RandomOf[T]) Add(value T) {
+	if isSpecial(value) {
+		var ok bool
+		if value, ok = r.special(value, 1); !ok {
+			return
+		}
+	}
+
+	r.sum += float64(value)
+	r.observe(value)
+	r.add(value)
+}
+
+// add counts the value, adding it to the buffers if it was chosen.
+func (r *sampler[T]) add(value T) {
 	// increment our counters
 	r.n++
 	r.count++
@@ -153,7 +348,114 @@ func (r *Random) Add(value float64) {
 		return
 	}
 
-	// we are so add the value into the buffer
+	r.push()
+}
+
+// AddWeighted puts the value in the quantile estimator as if Add had been
+// called weight times with it. It does nothing if weight is not positive.
+func (r *RandomOf[T]) AddWeighted(value T, weight int64) {
+	if weight <= 0 {
+		return
+	}
+	if isSpecial(value) {
+		var ok bool
+		if value, ok = r.special(value, weight); !ok {
+			return
+		}
+	}
+	r.sum += float64(value) * float64(weight)
+	r.observe(value)
+
+	for weight > 0 {
+		// observe as many copies of the value as we can before the current
+		// reservoir is complete.
+		step := int64(1<<r.level - r.count)
+		if step > weight {
+			step = weight
+		}
+
+		// check if we should keep this value in the reservoir
+		if r.chosen > r.count && int64(r.chosen-r.count) <= step {
+			r.reservoir = value
+		}
+
+		// increment our counters
+		r.n += step
+		r.count += int(step)
+		weight -= step
+
+		// check if we're ready to add this value to the buffer
+		if r.count < 1<<r.level {
+			return
+		}
+
+		r.push()
+	}
+}
+
+// AddSlice puts all of the values in the quantile estimator as if Add had been
+// called with each of them in order.
+func (r *RandomOf[T]) AddSlice(values []T) {
+	// keep the statistics in locals so that this loop stays tight.
+	min, max, sum := r.min, r.max, r.sum
+	for i, value := range values {
+		// special values have to be handled one at a time so that they can
+		// be dropped or replaced.
+		if isSpecial(value) {
+			r.min, r.max, r.sum = min, max, sum
+			r.sample(values[:i])
+			for _, value := range values[i:] {
+				r.Add(value)
+			}
+			return
+		}
+
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+		sum += float64(value)
+	}
+
+	r.min, r.max, r.sum = min, max, sum
+	r.sample(values)
+}
+
+// sample counts the values and adds the chosen ones to the buffers without
+// looking at any of the others. the caller is responsible for the statistics.
+func (r *sampler[T]) sample(values []T) {
+	for len(values) > 0 {
+		// only the chosen value out of every 1 << level values is kept, so
+		// skip over as many values as we can before the current reservoir is
+		// complete, keeping the chosen one if we pass it.
+		step := 1<<r.level - r.count
+		if step > len(values) {
+			step = len(values)
+		}
+		if idx := r.chosen - r.count - 1; idx >= 0 && idx < step {
+			r.reservoir = values[idx]
+		}
+
+		// increment our counters
+		r.n += int64(step)
+		r.count += step
+		values = values[step:]
+
+		// check if we're ready to add this value to the buffer
+		if r.count < 1<<r.level {
+			return
+		}
+
+		r.push()
+	}
+}
+
+// push adds the value in the reservoir into the current buffer, finding a new
+// buffer to fill if it becomes full.
+func (r *sampler[T]) push() {
+	// add the value into the buffer
 	r.cur.Data = append(r.cur.Data, r.reservoir)
 
 	// if we still have room, nothing left to do besides pick what the next
@@ -210,7 +512,7 @@ func (r *Random) Add(value float64) {
 		}
 
 		// search for the first two buckets with min_level
-		var b *Buffer
+		var b *BufferOf[T]
 		for i := range r.buffers {
 			buf := &r.buffers[i]
 			if buf.Level != min_level {
@@ -240,24 +542,141 @@ func (r *Random) Add(value float64) {
 	}
 }
 
-// Summarize is a helper that returns a Summary for a Random.
-func (r *Random) Summarize() Summary {
-	return r.Finish().Summarize()
+// Summarize is a helper that returns a Summary for a Random. It is safe to
+// continue calling Add after Summarize.
+func (r *RandomOf[T]) Summarize() SummaryOf[T] {
+	return r.Snapshot().Summarize()
 }
 
-// FinishedRandom represents a full collection of a Random value.
-type FinishedRandom struct {
+// FinishedRandomOf represents a full collection of a RandomOf value.
+type FinishedRandomOf[T Value] struct {
 	E       float64
 	N       int64
-	Buffers []Buffer
+	Buffers []BufferOf[T]
+
+	// Min, Max and Sum are the exact minimum, maximum and sum of the observed
+	// values. If nothing was observed, Min and Max are the highest and lowest
+	// values of T, which are +Inf and -Inf for floating point types.
+	Min T
+	Max T
+	Sum float64
+
+	// NaNs is the number of NaN values that were dropped or replaced with an
+	// infinity, and Infs is the number of infinite values that were observed,
+	// including the replaced NaNs. Dropped NaNs are not included in N.
+	NaNs int64
+	Infs int64
+
+	// ExtraError is how far the rank of any value may be off from the
+	// guarantee given by E because of resampling done by Merge.
+	ExtraError int64
 }
 
+// FinishedRandom is a FinishedRandomOf float64 values.
+type FinishedRandom = FinishedRandomOf[float64]
+
 // Finish returns a FinishedRandom that can be merged and summarized. It is
 // unsafe to call Add on Random after Finish has been called.
-func (r *Random) Finish() FinishedRandom {
-	return FinishedRandom{
+func (r *RandomOf[T]) Finish() FinishedRandomOf[T] {
+	return FinishedRandomOf[T]{
 		E:       r.e,
 		N:       r.n,
 		Buffers: r.buffers,
+		Min:     r.min,
+		Max:     r.max,
+		Sum:     r.sum,
+		NaNs:    r.nans,
+		Infs:    r.infs,
+	}
+}
+
+// Snapshot returns a FinishedRandom that is a deep copy of the current state
+// of the Random. Unlike Finish, it is safe to continue calling Add after
+// Snapshot has been called, and the returned value is unaffected by it.
+func (r *RandomOf[T]) Snapshot() FinishedRandomOf[T] {
+	return FinishedRandomOf[T]{
+		E:       r.e,
+		N:       r.n,
+		Buffers: copyBuffers(r.buffers),
+		Min:     r.min,
+		Max:     r.max,
+		Sum:     r.sum,
+		NaNs:    r.nans,
+		Infs:    r.infs,
+	}
+}
+
+// maxLevel is the largest level a buffer can have without overflowing the
+// ranks computed during summarization.
+const maxLevel = 62
+
+// validate checks that the FinishedRandom is something that could have been
+// produced by a Random or by Merge. It is used to reject bad input when
+// decoding.
+func (r FinishedRandomOf[T]) validate() error {
+	if !validEps(r.E) {
+		return fmt.Errorf("bad finished random: epsilon %v out of range", r.E)
+	}
+	if r.N < 0 {
+		return fmt.Errorf("bad finished random: negative count %d", r.N)
+	}
+	if r.NaNs < 0 || r.Infs < 0 {
+		return fmt.Errorf("bad finished random: negative special counts")
+	}
+	if r.ExtraError < 0 {
+		return fmt.Errorf("bad finished random: negative extra error")
+	}
+	if r.N > 0 && r.Min > r.Max {
+		return fmt.Errorf("bad finished random: min %v > max %v", r.Min, r.Max)
+	}
+
+	b, s := paramsFromEps(r.E)
+	if len(r.Buffers) > b {
+		return fmt.Errorf("bad finished random: %d buffers > %d",
+			len(r.Buffers), b)
+	}
+
+	for i, buf := range r.Buffers {
+		if buf.Level < -1 || buf.Level > maxLevel {
+			return fmt.Errorf("bad finished random: buffer %d level %d",
+				i, buf.Level)
+		}
+		if buf.Level == -1 && len(buf.Data) > 0 {
+			return fmt.Errorf("bad finished random: buffer %d cleared with "+
+				"data", i)
+		}
+		if len(buf.Data) > s {
+			return fmt.Errorf("bad finished random: buffer %d length %d > %d",
+				i, len(buf.Data), s)
+		}
+		for _, value := range buf.Data {
+			if value != value {
+				return fmt.Errorf("bad finished random: buffer %d has NaN", i)
+			}
+		}
+		if buf.Sorted && !slices.IsSorted(buf.Data) {
+			return fmt.Errorf("bad finished random: buffer %d not sorted", i)
+		}
+	}
+
+	return nil
+}
+
+// estimateStats sets Min, Max and Sum from the values in the buffers. It is
+// used when decoding the default JSON encoding of the struct, which doesn't
+// have them, and after a DecayingRandom decays its values.
+func (r *FinishedRandomOf[T]) estimateStats() {
+	r.Max, r.Min = extremes[T]()
+	r.Sum = 0
+	for _, buf := range r.Buffers {
+		for _, value := range buf.Data {
+			if value < r.Min {
+				r.Min = value
+			}
+			if value > r.Max {
+				r.Max = value
+			}
+			r.Sum += float64(value) * float64(int64(1)<<uint(buf.Level))
+		}
 	}
 }
@@ -5,6 +5,7 @@ package random
 import (
 	"math"
 	"math/rand"
+	"reflect"
 	"testing"
 )
 
@@ -70,6 +71,298 @@ func TestEstimateEpsilon(t *testing.T) {
 	}
 }
 
+func TestSnapshot(t *testing.T) {
+	r := NewRandom(0.01)
+	Seed(r, rand.NormFloat64)
+
+	snap := r.Snapshot()
+	s := snap.Summarize()
+	queries := make([]float64, 0)
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		queries = append(queries, s.Query(ptile))
+	}
+	before, err := snap.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keep adding values after the snapshot. the snapshot should not change.
+	for i := 0; i < 100000; i++ {
+		r.Add(rand.Float64() + 100)
+	}
+
+	after, err := snap.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatalf("snapshot changed after Add")
+	}
+	s = snap.Summarize()
+	for i, ptile := 0, 0.0; ptile <= 1.0; i, ptile = i+1, ptile+0.01 {
+		if query := s.Query(ptile); query != queries[i] {
+			t.Fatalf("%0.2f: %v != %v", ptile, query, queries[i])
+		}
+	}
+
+	// the random should reflect everything that was added.
+	if n := r.Snapshot().N; n != 200000 {
+		t.Fatalf("expected 200000 values: %d", n)
+	}
+	if query := r.Summarize().Query(0.99); query < 100 {
+		t.Fatalf("expected values after the snapshot: %v", query)
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	for _, eps := range []float64{0.5, 0.1, 0.01, 0.001} {
+		t.Logf("eps:%v", eps)
+
+		seed := uint64(rand.Int63())
+		r1 := NewRandomWithSeed(eps, seed)
+		r2 := NewRandomWithSeed(eps, seed)
+
+		for i := 0; i < 1000; i++ {
+			value, weight := rand.NormFloat64(), rand.Int63n(2000)-10
+			for j := int64(0); j < weight; j++ {
+				r1.Add(value)
+			}
+			r2.AddWeighted(value, weight)
+		}
+
+		// the weighted adds make the exact same choices as the repeated ones,
+		// but the sums may be rounded differently.
+		f1, f2 := r1.Finish(), r2.Finish()
+		if math.Abs(f1.Sum-f2.Sum) > 1e-6*math.Abs(f1.Sum) {
+			t.Fatalf("sum %v != %v", f1.Sum, f2.Sum)
+		}
+		f2.Sum = f1.Sum
+		if !reflect.DeepEqual(f1, f2) {
+			t.Fatalf("AddWeighted differs from repeated Add")
+		}
+	}
+}
+
+func TestAddSlice(t *testing.T) {
+	for _, eps := range []float64{0.5, 0.1, 0.01, 0.001} {
+		t.Logf("eps:%v", eps)
+
+		seed := uint64(rand.Int63())
+		r1 := NewRandomWithSeed(eps, seed)
+		r2 := NewRandomWithSeed(eps, seed)
+
+		for i := 0; i < 1000; i++ {
+			values := make([]float64, rand.Intn(2000))
+			for j := range values {
+				values[j] = rand.NormFloat64()
+				r1.Add(values[j])
+			}
+			r2.AddSlice(values)
+		}
+
+		// the slice adds make the exact same choices as the repeated ones.
+		if !reflect.DeepEqual(r1.Finish(), r2.Finish()) {
+			t.Fatalf("AddSlice differs from repeated Add")
+		}
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	rs := make([]FinishedRandom, 0)
+	min, max, sum, n := math.Inf(1), math.Inf(-1), 0.0, 0
+
+	for i := 0; i < 5; i++ {
+		r := NewRandom(0.01)
+		for j := 0; j < 10000; j++ {
+			value := rand.NormFloat64()
+			r.Add(value)
+			min, max, sum, n = math.Min(min, value), math.Max(max, value),
+				sum+value, n+1
+		}
+		rs = append(rs, r.Finish())
+	}
+
+	f, err := Merge(uint64(rand.Int63()), rs[0], rs[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Summarize()
+
+	if s.Min() != min || s.Query(0) != min {
+		t.Fatalf("expected min %v: %v %v", min, s.Min(), s.Query(0))
+	}
+	if s.Max() != max || s.Query(1) != max {
+		t.Fatalf("expected max %v: %v %v", max, s.Max(), s.Query(1))
+	}
+	if math.Abs(s.Sum()-sum) > 1e-9 {
+		t.Fatalf("expected sum %v: %v", sum, s.Sum())
+	}
+	if mean := sum / float64(n); math.Abs(s.Mean()-mean) > 1e-9 {
+		t.Fatalf("expected mean %v: %v", mean, s.Mean())
+	}
+}
+
+func TestNaNPolicy(t *testing.T) {
+	add := func(policy NaNPolicy) (*Random, int) {
+		r := NewRandom(0.01)
+		r.SetNaNPolicy(policy)
+
+		rejected := 0
+		for i := 0; i < 100000; i++ {
+			var value float64
+			switch i % 10 {
+			case 0:
+				value = math.NaN()
+			case 1:
+				value = math.Copysign(math.NaN(), -1)
+			case 2:
+				value = math.Inf(1)
+			case 3:
+				value = math.Inf(-1)
+			default:
+				value = rand.NormFloat64()
+			}
+
+			// exercise all of the ways of adding values.
+			switch i % 3 {
+			case 0:
+				if r.TryAdd(value) != nil {
+					rejected++
+				}
+			case 1:
+				r.AddWeighted(value, 1)
+			case 2:
+				r.AddSlice([]float64{value})
+			}
+		}
+		return r, rejected
+	}
+
+	check := func(policy NaNPolicy, n, nans, infs int64, rejected int) {
+		r, got_rejected := add(policy)
+		f := r.Finish()
+		t.Logf("policy:%d n:%d nans:%d infs:%d rejected:%d",
+			policy, f.N, f.NaNs, f.Infs, got_rejected)
+
+		if f.N != n || f.NaNs != nans || f.Infs != infs ||
+			got_rejected != rejected {
+			t.Fatalf("expected n:%d nans:%d infs:%d rejected:%d",
+				n, nans, infs, rejected)
+		}
+
+		s := f.Summarize()
+		last := s.Query(0)
+		if !math.IsInf(last, -1) || !math.IsInf(s.Query(1), 1) {
+			t.Fatalf("expected infinite extremes")
+		}
+		for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 256 {
+			query := s.Query(ptile)
+			if math.IsNaN(query) || query < last {
+				t.Fatalf("%0.3f: bad query %v after %v", ptile, query, last)
+			}
+			last = query
+			if cdf := s.CDF(query); math.IsNaN(cdf) {
+				t.Fatalf("%0.3f: NaN cdf for %v", ptile, query)
+			}
+		}
+	}
+
+	// a third of the NaNs are added with TryAdd, and so get rejected.
+	check(DropNaN, 80000, 20000, 20000, 0)
+	check(RejectNaN, 80000, 13333, 20000, 6667)
+	check(NaNAsInf, 100000, 20000, 40000, 0)
+}
+
+func TestNewRandomWithBudget(t *testing.T) {
+	for _, bytes := range []int{1 << 10, 1 << 12, 1 << 16, 1 << 20, 1 << 24} {
+		r, err := NewRandomWithBudget(bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eps := r.Epsilon()
+		used := memoryUsage(eps)
+		t.Logf("bytes:%d eps:%v used:%d", bytes, eps, used)
+
+		if used > bytes {
+			t.Fatalf("%d > %d", used, bytes)
+		}
+		if used < bytes/2 {
+			t.Fatalf("only used %d of %d", used, bytes)
+		}
+
+		Seed(r, rand.NormFloat64)
+		if f := r.Finish(); f.N != 100000 {
+			t.Fatalf("expected 100000 values: %d", f.N)
+		}
+	}
+
+	for _, bytes := range []int{-1, 0, 10, memoryUsage(0.99) - 1} {
+		if _, err := NewRandomWithBudget(bytes); err == nil {
+			t.Fatalf("%d: expected error", bytes)
+		} else {
+			t.Logf("%d: %v", bytes, err)
+		}
+	}
+	if _, err := NewRandomWithBudget(memoryUsage(0.99)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewRandomWithBudget_Options(t *testing.T) {
+	r1, err := NewRandomWithBudget(1<<16, WithSeed(5), WithNaNPolicy(RejectNaN))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2 := NewRandomWithSeed(r1.Epsilon(), 5)
+
+	if r1.TryAdd(math.NaN()) != ErrNaN {
+		t.Fatalf("expected NaN to be rejected")
+	}
+	for i := 0; i < 100000; i++ {
+		value := rand.NormFloat64()
+		r1.Add(value)
+		r2.Add(value)
+	}
+	if !reflect.DeepEqual(r1.Finish(), r2.Finish()) {
+		t.Fatalf("expected the same seed to make the same choices")
+	}
+}
+
+func TestReset(t *testing.T) {
+	r := NewRandom(0.01)
+	r.SetNaNPolicy(NaNAsInf)
+
+	for i := 0; i < 5; i++ {
+		seed := uint64(rand.Int63())
+		r.Reset(seed)
+
+		fresh := NewRandomWithSeed(0.01, seed)
+		fresh.SetNaNPolicy(NaNAsInf)
+
+		count := rand.Intn(200000)
+		for j := 0; j < count; j++ {
+			value := rand.NormFloat64()
+			if j%1000 == 0 {
+				value = math.NaN()
+			}
+			r.Add(value)
+			fresh.Add(value)
+		}
+
+		// a reset Random behaves exactly like a new one.
+		if !reflect.DeepEqual(r.Finish(), fresh.Finish()) {
+			t.Fatalf("reset random differs from a new one")
+		}
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		r.Reset(uint64(rand.Int63()))
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocations: %v", allocs)
+	}
+}
+
 //
 // benchmarks
 //
@@ -106,12 +399,47 @@ func BenchmarkAddNormal_0001(b *testing.B) {
 	benchmarkAdd(b, rand.NormFloat64, 0.0001)
 }
 
+func benchmarkAddSlice(b *testing.B, cons func() float64, eps float64) {
+	values := make([]float64, 1024)
+	for i := range values {
+		values[i] = cons()
+	}
+	r := NewRandom(eps)
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i += len(values) {
+		r.AddSlice(values)
+	}
+}
+
+func BenchmarkAddSliceNormal_5(b *testing.B) {
+	benchmarkAddSlice(b, rand.NormFloat64, 0.5)
+}
+
+func BenchmarkAddSliceNormal_05(b *testing.B) {
+	benchmarkAddSlice(b, rand.NormFloat64, 0.05)
+}
+
+func BenchmarkAddSliceNormal_01(b *testing.B) {
+	benchmarkAddSlice(b, rand.NormFloat64, 0.01)
+}
+
+func BenchmarkAddSliceNormal_001(b *testing.B) {
+	benchmarkAddSlice(b, rand.NormFloat64, 0.001)
+}
+
+func BenchmarkAddSliceNormal_0001(b *testing.B) {
+	benchmarkAddSlice(b, rand.NormFloat64, 0.0001)
+}
+
 func benchmarkSummarize(b *testing.B, cons func() float64, eps float64) {
 	r := NewRandom(eps)
 	for i := 0; i < 100000; i++ {
 		r.Add(cons())
 	}
-	eles := make([]summaryElement, 0, r.b*r.s)
+	eles := make([]summaryElement[float64], 0, r.b*r.s)
 	f := r.Finish()
 
 	b.ResetTimer()
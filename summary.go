@@ -3,46 +3,90 @@
 package random
 
 import (
+	"cmp"
+	"fmt"
 	"math"
+	"slices"
 	"sort"
 )
 
 // summaryElement is a list of elements for a summary for fast queries.
-type summaryElement struct {
+type summaryElement[T cmp.Ordered] struct {
 	rank  int64
-	value float64
+	value T
 }
 
-// Summary is produced by a Random and can answer queries about the
-// distribution that was observed.
-type Summary struct {
+// summaryCore is what SummaryOf and KeySummary have in common: the elements
+// sorted by value with their ranks, the exact extremes and the error bound.
+type summaryCore[T cmp.Ordered] struct {
 	n        float64
-	elements []summaryElement
+	elements []summaryElement[T]
+
+	// the exact extremes from the finished random.
+	min T
+	max T
+
+	// bound is how far off the rank of any value may be.
+	bound int64
+}
+
+// SummaryOf is produced by a RandomOf and can answer queries about the
+// distribution that was observed.
+type SummaryOf[T Value] struct {
+	summaryCore[T]
+
+	// the exact sum from the FinishedRandom.
+	sum float64
 }
 
-// numElements returns the number of elements stored in the finished Random.
-func (r FinishedRandom) numElements() int {
-	if len(r.Buffers) == 0 {
+// Summary is a SummaryOf float64 values.
+type Summary = SummaryOf[float64]
+
+// numElements returns the number of elements stored in the buffers of a
+// finished Random.
+func numElements[T cmp.Ordered](buffers []BufferOf[T]) int {
+	if len(buffers) == 0 {
 		return 0
 	}
-	return len(r.Buffers) * len(r.Buffers[0].Data)
+	return len(buffers) * len(buffers[0].Data)
 }
 
 // Summarize creates a Summary for querying.
-func (r FinishedRandom) Summarize() Summary {
+func (r FinishedRandomOf[T]) Summarize() SummaryOf[T] {
 	// factor out the allocation for benchmarking.
-	return r.summarize(make([]summaryElement, 0, r.numElements()))
+	return r.summarize(make([]summaryElement[T], 0, numElements(r.Buffers)))
 }
 
-func (r FinishedRandom) summarize(elements []summaryElement) Summary {
+func (r FinishedRandomOf[T]) summarize(elements []summaryElement[T]) (
+	s SummaryOf[T]) {
+
+	return SummaryOf[T]{
+		summaryCore: summaryCore[T]{
+			n:        float64(r.N),
+			elements: summarizeBuffers(r.Buffers, elements),
+
+			min: r.Min,
+			max: r.Max,
+
+			bound: int64(math.Ceil(r.E*float64(r.N))) + r.ExtraError,
+		},
+		sum: r.Sum,
+	}
+}
+
+// summarizeBuffers appends the values in the buffers to elements in sorted
+// order, with each rank being the number of observations below the value.
+func summarizeBuffers[T cmp.Ordered](buffers []BufferOf[T],
+	elements []summaryElement[T]) []summaryElement[T] {
+
 	// we summarize in a two step process. step one is to create a slice of
 	// summary elements with the rank actually being the level. step two is
 	// to create a rolling sum of the levels and fix up the ranks.
 
 	// make the slices that we're going to sort with their associated levels.
-	items := make([]mergeItem, 0, len(r.Buffers))
-	for i := range r.Buffers {
-		buf := &r.Buffers[i]
+	items := make([]mergeItem[T], 0, len(buffers))
+	for i := range buffers {
+		buf := &buffers[i]
 
 		// if the buffer has no data, there's no point in considering it for
 		// merging
@@ -56,7 +100,7 @@ func (r FinishedRandom) summarize(elements []summaryElement) Summary {
 		}
 
 		// add the merge buffer and associate the data with the level.
-		items = append(items, mergeItem{
+		items = append(items, mergeItem[T]{
 			data:  buf.Data,
 			level: int64(buf.Level),
 		})
@@ -71,25 +115,326 @@ func (r FinishedRandom) summarize(elements []summaryElement) Summary {
 		if !ok {
 			break
 		}
-		elements = append(elements, summaryElement{
+		elements = append(elements, summaryElement[T]{
 			rank:  rank,
 			value: value,
 		})
 		rank += (1 << uint64(level))
 	}
 
-	return Summary{
-		n:        float64(r.N),
-		elements: elements,
+	return elements
+}
+
+// validate checks that the Summary is something that could have been produced
+// by Summarize. It is used to reject bad input when decoding.
+func (s SummaryOf[T]) validate() error {
+	if !(s.n >= 0) || math.IsInf(s.n, 0) {
+		return fmt.Errorf("bad summary: count %v out of range", s.n)
+	}
+	if s.bound < 0 {
+		return fmt.Errorf("bad summary: negative bound %d", s.bound)
+	}
+	if s.n > 0 && s.min > s.max {
+		return fmt.Errorf("bad summary: min %v > max %v", s.min, s.max)
 	}
+	for i, ele := range s.elements {
+		if ele.rank < 0 {
+			return fmt.Errorf("bad summary: element %d negative rank", i)
+		}
+		if ele.value != ele.value {
+			return fmt.Errorf("bad summary: element %d is NaN", i)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := s.elements[i-1]
+		if ele.rank <= prev.rank {
+			return fmt.Errorf("bad summary: element %d rank not increasing", i)
+		}
+		if ele.value < prev.value {
+			return fmt.Errorf("bad summary: element %d value not sorted", i)
+		}
+	}
+	return nil
 }
 
-// Query returns the estimated value at the given percentile.
-func (s Summary) Query(ptile float64) float64 {
-	target := int64(math.Ceil(s.n * ptile))
-	idx := sort.Search(len(s.elements), func(idx int) bool {
+// Interpolation controls the value returned by a query for a percentile that
+// falls between two elements of a Summary. The modes mirror the methods of the
+// same name in NumPy's quantile function.
+type Interpolation int
+
+const (
+	// InterpolateLinear returns a value linearly interpolated between the
+	// elements by rank.
+	InterpolateLinear Interpolation = iota
+
+	// InterpolateLower returns the value of the lower element.
+	InterpolateLower
+
+	// InterpolateHigher returns the value of the higher element.
+	InterpolateHigher
+
+	// InterpolateNearest returns the value of the element nearest by rank,
+	// or the one with an even index if they are equally near.
+	InterpolateNearest
+
+	// InterpolateMidpoint returns the average of the values of the elements.
+	InterpolateMidpoint
+)
+
+// Empty reports whether the summary has no values to answer queries with.
+func (s summaryCore[T]) Empty() bool {
+	return len(s.elements) == 0
+}
+
+// lookup returns the value at the percentile, using pick to choose it by the
+// rank the percentile targets. The 0th and 100th percentiles are the exact
+// extremes, and percentiles outside of [0, 1] are clamped to them. It reports
+// false if the summary is empty or the percentile is NaN.
+func (s summaryCore[T]) lookup(ptile float64, pick func(target int64) T) (
+	value T, ok bool) {
+
+	switch {
+	case s.Empty() || math.IsNaN(ptile):
+		return value, false
+	case ptile <= 0:
+		return s.min, true
+	case ptile >= 1:
+		return s.max, true
+	}
+	return pick(int64(math.Ceil(s.n * ptile))), true
+}
+
+// search returns the index of the first element with a rank at least the
+// target.
+func (s summaryCore[T]) search(target int64) int {
+	return sort.Search(len(s.elements), func(idx int) bool {
 		return s.elements[idx].rank >= target
 	})
+}
+
+// Query returns the estimated value at the given percentile, linearly
+// interpolated between the elements around it. The 0th and 100th percentiles
+// are the exact minimum and maximum observed values, and percentiles outside
+// of [0, 1] are clamped to them. It returns NaN if the Summary is empty or the
+// percentile is NaN, or zero instead of NaN for integer types.
+func (s SummaryOf[T]) Query(ptile float64) T {
+	return s.QueryWith(ptile, InterpolateLinear)
+}
+
+// QueryOK is like Query but reports false instead of returning a value if the
+// Summary is empty or the percentile is not within [0, 1].
+func (s SummaryOf[T]) QueryOK(ptile float64) (value T, ok bool) {
+	if s.Empty() || !(ptile >= 0 && ptile <= 1) {
+		return missing[T](), false
+	}
+	return s.Query(ptile), true
+}
+
+// QueryWith is like Query but uses the given mode to choose the value when
+// the percentile falls between elements.
+func (s SummaryOf[T]) QueryWith(ptile float64, mode Interpolation) T {
+	value, ok := s.lookup(ptile, func(target int64) T {
+		return s.queryRank(target, mode)
+	})
+	if !ok {
+		return missing[T]()
+	}
+	return value
+}
+
+// queryRank returns the estimated value with the target rank.
+func (s SummaryOf[T]) queryRank(target int64, mode Interpolation) T {
+	return s.interpolate(s.search(target), target, mode)
+}
+
+// RankErrorBound returns how far the estimated rank of any value may be from
+// its true rank. It is the bound guaranteed with high probability by the
+// algorithm for the epsilon, plus any error added by resampling in Merge.
+func (s summaryCore[T]) RankErrorBound() int64 {
+	return s.bound
+}
+
+// QueryInterval returns the range of values that the value at the given
+// percentile could be, given the RankErrorBound. It returns what Query does if
+// the Summary is empty or the percentile is NaN.
+func (s SummaryOf[T]) QueryInterval(ptile float64) (lo, hi T) {
+	if s.Empty() || math.IsNaN(ptile) {
+		return missing[T](), missing[T]()
+	}
+
+	target := int64(math.Ceil(s.n * math.Max(0, math.Min(1, ptile))))
+	lo, hi = s.min, s.max
+	if low := target - s.bound; low > 0 {
+		lo = s.queryRank(low, InterpolateLower)
+	}
+	if high := target + s.bound; float64(high) < s.n {
+		hi = s.queryRank(high, InterpolateHigher)
+	}
+	return lo, hi
+}
+
+// quantilesChunk is how many unsorted percentiles Quantiles answers in each
+// pass, so that their sorted order fits on the stack.
+const quantilesChunk = 64
+
+// Quantiles returns the estimated values at each of the given percentiles by
+// appending them to out[:0]. The percentiles are answered in sorted order in a
+// single forward pass over the summary, or one pass per 64 percentiles if they
+// are not sorted. No allocations are made if out has enough capacity.
+func (s SummaryOf[T]) Quantiles(ptiles []float64, out []T) []T {
+	out = slices.Grow(out[:0], len(ptiles))[:len(ptiles)]
+
+	if sort.Float64sAreSorted(ptiles) {
+		c := quantileCursor[T]{s: s}
+		for i, ptile := range ptiles {
+			out[i] = c.query(ptile)
+		}
+		return out
+	}
+
+	var order [quantilesChunk]int
+	for start := 0; start < len(ptiles); start += quantilesChunk {
+		chunk := order[:min(quantilesChunk, len(ptiles)-start)]
+		for i := range chunk {
+			chunk[i] = start + i
+		}
+		slices.SortFunc(chunk, func(a, b int) int {
+			return cmp.Compare(ptiles[a], ptiles[b])
+		})
+
+		c := quantileCursor[T]{s: s}
+		for _, i := range chunk {
+			out[i] = c.query(ptiles[i])
+		}
+	}
+	return out
+}
+
+// quantileCursor answers queries for percentiles in sorted order, where NaN
+// sorts first, by only searching the elements after the previous answer.
+type quantileCursor[T Value] struct {
+	s   SummaryOf[T]
+	idx int
+}
+
+// query returns what Query would for the percentile, which must be at least
+// the previous one.
+func (c *quantileCursor[T]) query(ptile float64) T {
+	value, ok := c.s.lookup(ptile, func(target int64) T {
+		rest := c.s.elements[c.idx:]
+		c.idx += sort.Search(len(rest), func(idx int) bool {
+			return rest[idx].rank >= target
+		})
+		return c.s.interpolate(c.idx, target, InterpolateLinear)
+	})
+	if !ok {
+		return missing[T]()
+	}
+	return value
+}
+
+// SplitPoints returns k-1 observed values that divide the distribution into k
+// ranges of roughly equal count, along with the estimated count of each range.
+// The ith range holds the values at least splits[i-1] and less than splits[i],
+// where the first and last ranges are unbounded below and above. Since splits
+// are observed values, a value observed more often than N/k may be repeated,
+// leaving empty ranges between the repeats. The counts are taken from the
+// ranks of the elements, so they sum to N. It returns nils if the summary is
+// empty, and treats k less than 1 as 1.
+func (s summaryCore[T]) SplitPoints(k int) (splits []T, counts []int64) {
+	if s.Empty() {
+		return nil, nil
+	}
+	if k < 1 {
+		k = 1
+	}
+
+	splits = make([]T, 0, k-1)
+	counts = make([]int64, 0, k)
+	prev := int64(0)
+	for i := 1; i < k; i++ {
+		idx := s.search(int64(math.Ceil(s.n * float64(i) / float64(k))))
+		if idx >= len(s.elements) {
+			idx = len(s.elements) - 1
+		}
+
+		// equal values may be in many elements, so use the first one to
+		// count everything below the value.
+		value := s.elements[idx].value
+		idx = sort.Search(idx, func(idx int) bool {
+			return s.elements[idx].value >= value
+		})
+		splits = append(splits, value)
+
+		// a merge can leave more weight in the buffers than was observed, so
+		// keep the ranks within N to keep the last count from going negative.
+		rank := s.elements[idx].rank
+		if rank > int64(s.n) {
+			rank = int64(s.n)
+		}
+		counts = append(counts, rank-prev)
+		prev = rank
+	}
+	counts = append(counts, int64(s.n)-prev)
+
+	return splits, counts
+}
+
+// Histogram returns the estimated number of observed values in each of the
+// buckets divided by the sorted bounds. The ith bucket holds the values at
+// least bounds[i-1] and less than bounds[i], where the first and last buckets
+// are unbounded below and above, so there is one more count than bounds. The
+// counts are taken from the ranks of the bounds, so they sum to N.
+func (s SummaryOf[T]) Histogram(bounds []T) []int64 {
+	counts := make([]int64, 0, len(bounds)+1)
+	prev := int64(0)
+	for _, bound := range bounds {
+		// keep the counts from going negative if the bounds aren't sorted.
+		// Rank is within N, so the last count can't go negative either.
+		rank := s.Rank(bound)
+		if rank < prev {
+			rank = prev
+		}
+		counts = append(counts, rank-prev)
+		prev = rank
+	}
+	return append(counts, int64(s.n)-prev)
+}
+
+// EquiDepthHistogram returns the edges of the given number of buckets that
+// each hold about the same number of observed values, along with the estimated
+// count of each bucket. The ith bucket holds the values at least edges[i] and
+// less than edges[i+1], except the last one also holds the maximum. The first
+// and last edges are the exact minimum and maximum. It returns nils if the
+// Summary is empty, and treats buckets less than 1 as 1.
+func (s SummaryOf[T]) EquiDepthHistogram(buckets int) (edges []T,
+	counts []int64) {
+
+	if s.Empty() {
+		return nil, nil
+	}
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	ptiles := make([]float64, 0, buckets+1)
+	for i := 0; i <= buckets; i++ {
+		ptiles = append(ptiles, float64(i)/float64(buckets))
+	}
+	edges = s.Quantiles(ptiles, make([]T, 0, len(ptiles)))
+
+	// every value is within the outer edges, so the inner edges alone divide
+	// the values into the buckets.
+	counts = s.Histogram(edges[1 : len(edges)-1])
+	return edges, counts
+}
+
+// interpolate returns the estimated value with the target rank, where idx is
+// the index of the first element with a rank at least the target.
+func (s SummaryOf[T]) interpolate(idx int, target int64,
+	mode Interpolation) T {
+
 	if idx >= len(s.elements) {
 		return s.elements[len(s.elements)-1].value
 	}
@@ -104,6 +449,141 @@ func (s Summary) Query(ptile float64) float64 {
 		return s.elements[above_idx].value
 	}
 	below, above := s.elements[below_idx], s.elements[above_idx]
+
+	// the target is always above the lower element, so if it's not below the
+	// higher one, we found it exactly.
+	if above.rank == target {
+		return above.value
+	}
+
 	x := float64(target-below.rank) / float64(above.rank-below.rank)
-	return below.value + (above.value-below.value)*x
+	switch mode {
+	case InterpolateLower:
+		return below.value
+	case InterpolateHigher:
+		return above.value
+	case InterpolateNearest:
+		if x < 0.5 || (x == 0.5 && below_idx%2 == 0) {
+			return below.value
+		}
+		return above.value
+	case InterpolateMidpoint:
+		return lerp(below.value, above.value, 0.5)
+	default:
+		return lerp(below.value, above.value, x)
+	}
+}
+
+// lerp linearly interpolates between a and b, which must be ordered, taking
+// care that infinite endpoints don't produce NaN. integer results are rounded
+// to the nearest value without overflowing.
+func lerp[T Value](a, b T, x float64) T {
+	switch {
+	case a == b:
+		return a
+	case isInf(a, -1) && isInf(b, 1):
+		if x < 0.5 {
+			return a
+		}
+		return b
+	case isInf(a, -1):
+		return a
+	case isInf(b, 1):
+		return b
+	}
+
+	if kindOf[T]() == kindFloat {
+		return a + (b-a)*T(x)
+	}
+
+	// the offset is computed in uint64 so that it can span the whole range,
+	// and adding it wraps around to the right value for signed types too.
+	d := distance(a, b)
+	off := math.Round(d * x)
+	if off >= d {
+		return b
+	}
+	return a + T(uint64(off))
+}
+
+// Rank returns the estimated number of observed values less than the given
+// value. It returns 0 if the value is NaN.
+func (s SummaryOf[T]) Rank(value T) int64 {
+	if value != value {
+		return 0
+	}
+	return int64(math.Round(s.rank(value)))
+}
+
+// CDF returns the estimated fraction of observed values less than the given
+// value, or NaN if the Summary is empty or the value is NaN.
+func (s SummaryOf[T]) CDF(value T) float64 {
+	if s.Empty() || value != value {
+		return math.NaN()
+	}
+	return s.rank(value) / s.n
+}
+
+// rank returns the rank of the value, interpolated between the ranks of the
+// elements around it.
+func (s SummaryOf[T]) rank(value T) float64 {
+	idx := sort.Search(len(s.elements), func(idx int) bool {
+		return s.elements[idx].value >= value
+	})
+	if idx == 0 {
+		return 0
+	}
+	if idx >= len(s.elements) {
+		return s.n
+	}
+	below, above := s.elements[idx-1], s.elements[idx]
+
+	// the value is strictly between the elements, so it is above all of an
+	// infinite lower element and below all of an infinite higher element.
+	var x float64
+	switch {
+	case isInf(below.value, -1):
+		x = 1
+	case isInf(above.value, 1):
+		x = 0
+	default:
+		x = distance(below.value, value) / distance(below.value, above.value)
+	}
+
+	// a merge can leave more weight in the buffers than was observed, so
+	// keep the rank within N.
+	return math.Min(float64(below.rank)+float64(above.rank-below.rank)*x, s.n)
+}
+
+// Min returns the exact minimum observed value, or NaN if nothing was
+// observed, which is zero for integer types.
+func (s SummaryOf[T]) Min() T {
+	if s.n == 0 {
+		return missing[T]()
+	}
+	return s.min
+}
+
+// Max returns the exact maximum observed value, or NaN if nothing was
+// observed, which is zero for integer types.
+func (s SummaryOf[T]) Max() T {
+	if s.n == 0 {
+		return missing[T]()
+	}
+	return s.max
+}
+
+// Count returns the number of observed values.
+func (s SummaryOf[T]) Count() int64 { return int64(s.n) }
+
+// Sum returns the exact sum of the observed values.
+func (s SummaryOf[T]) Sum() float64 { return s.sum }
+
+// Mean returns the exact mean of the observed values, or NaN if nothing was
+// observed.
+func (s SummaryOf[T]) Mean() float64 {
+	if s.n == 0 {
+		return math.NaN()
+	}
+	return s.sum / s.n
 }
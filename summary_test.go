@@ -0,0 +1,572 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestCDF_Normal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i, eps := range []float64{0.1, 0.05, 0.01, 0.001} {
+		t.Logf("eps:%v", eps)
+
+		r := NewRandomWithSeed(eps, uint64(i))
+		Seed(r, rng.NormFloat64)
+		s := r.Summarize()
+
+		last := int64(0)
+		for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 64 {
+			query := s.Query(ptile)
+			cdf, ex := s.CDF(query), 0.5*(1+math.Erf(query/math.Sqrt2))
+			t.Logf("%0.2f,%v,%v,%v", ptile, query, cdf, ex)
+
+			// the cdf should invert the query, and be close to the exact one
+			// give or take the noise from only having 100000 samples.
+			if math.Abs(cdf-ptile) > eps {
+				t.Fatalf("%0.2f: cdf of query is %v", ptile, cdf)
+			}
+			if math.Abs(cdf-ex) > eps+0.005 {
+				t.Fatalf("%0.2f: cdf %v too far from %v", ptile, cdf, ex)
+			}
+
+			if rank := s.Rank(query); rank < last {
+				t.Fatalf("%v < %v", rank, last)
+			} else {
+				last = rank
+			}
+		}
+
+		if rank := s.Rank(math.Inf(-1)); rank != 0 {
+			t.Fatalf("expected rank 0 below everything: %d", rank)
+		}
+		if rank := s.Rank(math.Inf(1)); rank != r.Finish().N {
+			t.Fatalf("expected rank n above everything: %d", rank)
+		}
+	}
+}
+
+func TestQuantiles(t *testing.T) {
+	r := NewRandom(0.01)
+	Seed(r, rand.NormFloat64)
+	s := r.Summarize()
+
+	ptiles := make([]float64, 0)
+	for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 64 {
+		ptiles = append(ptiles, ptile)
+	}
+	out := make([]float64, 0, len(ptiles))
+
+	check := func() {
+		out = s.Quantiles(ptiles, out)
+		if len(out) != len(ptiles) {
+			t.Fatalf("expected %d results: %d", len(ptiles), len(out))
+		}
+		for i, ptile := range ptiles {
+			if query := s.Query(ptile); out[i] != query {
+				t.Fatalf("%0.2f: %v != %v", ptile, out[i], query)
+			}
+		}
+		allocs := testing.AllocsPerRun(10, func() {
+			out = s.Quantiles(ptiles, out)
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations: %v", allocs)
+		}
+	}
+
+	check()
+	rand.Shuffle(len(ptiles), func(i, j int) {
+		ptiles[i], ptiles[j] = ptiles[j], ptiles[i]
+	})
+	check()
+}
+
+func TestQueryWith_Elements(t *testing.T) {
+	s := Summary{summaryCore: summaryCore[float64]{
+		n: 12,
+		elements: []summaryElement[float64]{
+			{rank: 0, value: 1},
+			{rank: 4, value: 2},
+			{rank: 8, value: 3},
+		},
+		min: 1,
+		max: 3,
+	}}
+
+	modes := []Interpolation{
+		InterpolateLinear,
+		InterpolateLower,
+		InterpolateHigher,
+		InterpolateNearest,
+		InterpolateMidpoint,
+	}
+	cases := []struct {
+		ptile float64
+		exp   []float64
+	}{
+		{0.0 / 12, []float64{1, 1, 1, 1, 1}},
+		{4.0 / 12, []float64{2, 2, 2, 2, 2}},
+		{5.0 / 12, []float64{2.25, 2, 3, 2, 2.5}},
+		{6.0 / 12, []float64{2.5, 2, 3, 3, 2.5}},
+		{7.0 / 12, []float64{2.75, 2, 3, 3, 2.5}},
+		{8.0 / 12, []float64{3, 3, 3, 3, 3}},
+		{10.0 / 12, []float64{3, 3, 3, 3, 3}},
+		{12.0 / 12, []float64{3, 3, 3, 3, 3}},
+	}
+
+	for _, c := range cases {
+		for i, mode := range modes {
+			if got := s.QueryWith(c.ptile, mode); got != c.exp[i] {
+				t.Fatalf("%0.2f mode %d: %v != %v", c.ptile, mode, got, c.exp[i])
+			}
+		}
+	}
+}
+
+func TestQueryWith_Integers(t *testing.T) {
+	for _, eps := range []float64{0.1, 0.01, 0.001} {
+		t.Logf("eps:%v", eps)
+
+		r := NewRandom(eps)
+		Seed(r, func() float64 { return float64(rand.Intn(1000)) })
+		s := r.Summarize()
+
+		for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 256 {
+			linear := s.QueryWith(ptile, InterpolateLinear)
+			lower := s.QueryWith(ptile, InterpolateLower)
+			higher := s.QueryWith(ptile, InterpolateHigher)
+			nearest := s.QueryWith(ptile, InterpolateNearest)
+			midpoint := s.QueryWith(ptile, InterpolateMidpoint)
+			t.Logf("%0.3f,%v,%v,%v,%v,%v",
+				ptile, linear, lower, higher, nearest, midpoint)
+
+			// everything but linear and midpoint must be an observed value.
+			for _, value := range []float64{lower, higher, nearest} {
+				if value != math.Trunc(value) {
+					t.Fatalf("%0.3f: unobserved value %v", ptile, value)
+				}
+			}
+			if midpoint*2 != math.Trunc(midpoint*2) {
+				t.Fatalf("%0.3f: bad midpoint %v", ptile, midpoint)
+			}
+			if nearest != lower && nearest != higher {
+				t.Fatalf("%0.3f: nearest %v not lower or higher", ptile, nearest)
+			}
+			for _, value := range []float64{linear, nearest, midpoint} {
+				if value < lower || value > higher {
+					t.Fatalf("%0.3f: %v outside [%v, %v]",
+						ptile, value, lower, higher)
+				}
+			}
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for _, s := range []Summary{{}, NewRandom(0.01).Summarize()} {
+		if !s.Empty() {
+			t.Fatalf("expected empty summary")
+		}
+
+		for _, ptile := range []float64{-1, 0, 0.5, 1, 2, math.NaN()} {
+			if query := s.Query(ptile); !math.IsNaN(query) {
+				t.Fatalf("%v: expected NaN: %v", ptile, query)
+			}
+			if query, ok := s.QueryOK(ptile); ok || !math.IsNaN(query) {
+				t.Fatalf("%v: expected not ok: %v", ptile, query)
+			}
+		}
+		for _, query := range s.Quantiles([]float64{0, 0.5, 1}, nil) {
+			if !math.IsNaN(query) {
+				t.Fatalf("expected NaN: %v", query)
+			}
+		}
+
+		if rank := s.Rank(0); rank != 0 {
+			t.Fatalf("expected rank 0: %v", rank)
+		}
+		if cdf := s.CDF(0); !math.IsNaN(cdf) {
+			t.Fatalf("expected NaN cdf: %v", cdf)
+		}
+		for _, value := range []float64{s.Min(), s.Max(), s.Mean()} {
+			if !math.IsNaN(value) {
+				t.Fatalf("expected NaN: %v", value)
+			}
+		}
+		if sum := s.Sum(); sum != 0 {
+			t.Fatalf("expected zero sum: %v", sum)
+		}
+	}
+}
+
+func TestDegenerate(t *testing.T) {
+	r := NewRandom(0.01)
+	r.Add(5)
+	s := r.Summarize()
+
+	if s.Empty() {
+		t.Fatalf("expected non-empty summary")
+	}
+	for _, ptile := range []float64{0, 0.5, 1} {
+		if query, ok := s.QueryOK(ptile); !ok || query != 5 {
+			t.Fatalf("%v: expected 5: %v %v", ptile, query, ok)
+		}
+	}
+
+	// out of range percentiles are clamped by Query and rejected by QueryOK.
+	for _, ptile := range []float64{-1, -0.01, 1.01, 2, math.Inf(1)} {
+		if query := s.Query(ptile); query != 5 {
+			t.Fatalf("%v: expected 5: %v", ptile, query)
+		}
+		if _, ok := s.QueryOK(ptile); ok {
+			t.Fatalf("%v: expected not ok", ptile)
+		}
+	}
+	if query := s.Query(math.NaN()); !math.IsNaN(query) {
+		t.Fatalf("expected NaN: %v", query)
+	}
+	if _, ok := s.QueryOK(math.NaN()); ok {
+		t.Fatalf("expected not ok")
+	}
+	if cdf := s.CDF(math.NaN()); !math.IsNaN(cdf) {
+		t.Fatalf("expected NaN cdf: %v", cdf)
+	}
+}
+
+func TestRank_BelowN(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	r := NewRandomWithSeed(0.01, 1)
+	for i := 0; i < 1000000; i++ {
+		r.Add(rng.Float64())
+	}
+	s := r.Summarize()
+
+	// the ranks count the observations below each element, so even the last
+	// one must be below N.
+	last := s.elements[len(s.elements)-1]
+	if last.rank >= int64(s.n) {
+		t.Fatalf("last rank %d not below n %v", last.rank, s.n)
+	}
+	below := s.elements[len(s.elements)-2]
+	value := (below.value + last.value) / 2
+	if cdf := s.CDF(value); cdf > 1 {
+		t.Fatalf("cdf above 1: %v", cdf)
+	}
+}
+
+func TestRankErrorBound(t *testing.T) {
+	const n = 100000
+
+	// with the values 0 through n-1, the value at any rank is the rank.
+	check := func(f FinishedRandom) {
+		s := f.Summarize()
+		bound := s.RankErrorBound()
+		t.Logf("eps:%v extra:%d bound:%d", f.E, f.ExtraError, bound)
+
+		if exp := int64(math.Ceil(f.E*n)) + f.ExtraError; bound != exp {
+			t.Fatalf("expected bound %d: %d", exp, bound)
+		}
+		for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 256 {
+			exact := math.Min(math.Ceil(n*ptile), n-1)
+			query := s.Query(ptile)
+			lo, hi := s.QueryInterval(ptile)
+			if math.Abs(query-exact) > float64(bound) {
+				t.Fatalf("%0.3f: %v too far from %v", ptile, query, exact)
+			}
+			if exact < lo || exact > hi || query < lo || query > hi {
+				t.Fatalf("%0.3f: [%v, %v] doesn't contain %v and %v",
+					ptile, lo, hi, exact, query)
+			}
+		}
+	}
+
+	// the bound only holds with high probability, so seed everything to
+	// keep the test deterministic.
+	rng := rand.New(rand.NewSource(1))
+	values := make([]float64, n)
+	for i, v := range rng.Perm(n) {
+		values[i] = float64(v)
+	}
+
+	for i, eps := range []float64{0.1, 0.05, 0.01, 0.001} {
+		r := NewRandomWithSeed(eps, uint64(i))
+		r.AddSlice(values)
+		check(r.Finish())
+	}
+
+	// merging sketches of different epsilons adds error to the bound.
+	epss := []float64{0.01, 0.05, 0.001, 0.02}
+	rs := make([]FinishedRandom, 0, len(epss))
+	for i, eps := range epss {
+		r := NewRandomWithSeed(eps, uint64(i))
+		r.AddSlice(values[i*n/len(epss) : (i+1)*n/len(epss)])
+		rs = append(rs, r.Finish())
+	}
+	f, err := Merge(1, rs[0], rs[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.ExtraError == 0 {
+		t.Fatalf("expected extra error from resampling")
+	}
+	check(f)
+}
+
+func TestSplitPoints(t *testing.T) {
+	const n = 100000
+
+	values := make([]float64, n)
+	for i, v := range rand.Perm(n) {
+		values[i] = float64(v)
+	}
+	r := NewRandom(0.01)
+	r.AddSlice(values)
+	s := r.Summarize()
+
+	for _, k := range []int{1, 2, 4, 10, 33} {
+		splits, counts := s.SplitPoints(k)
+		t.Logf("k:%d splits:%v counts:%v", k, splits, counts)
+		if len(splits) != k-1 || len(counts) != k {
+			t.Fatalf("bad lengths: %d %d", len(splits), len(counts))
+		}
+
+		// the values 0 through n-1 make the exact count of each range the
+		// difference of its bounds.
+		sum, lo := int64(0), 0.0
+		for i, count := range counts {
+			hi := float64(n)
+			if i < len(splits) {
+				hi = splits[i]
+			}
+			if math.Abs(float64(count)-(hi-lo)) > 0.02*n {
+				t.Fatalf("range %d [%v, %v) bad count %d", i, lo, hi, count)
+			}
+			if math.Abs(hi-lo-float64(n)/float64(k)) > 0.02*n {
+				t.Fatalf("range %d [%v, %v) not about n/k", i, lo, hi)
+			}
+			sum += count
+			lo = hi
+		}
+		if sum != n {
+			t.Fatalf("counts sum to %d", sum)
+		}
+	}
+
+	// a value that is most of the distribution is repeated, leaving empty
+	// ranges between the repeats.
+	r = NewRandom(0.01)
+	for i := 0; i < n; i++ {
+		if i%10 == 0 {
+			r.Add(float64(i))
+		} else {
+			r.Add(-1)
+		}
+	}
+	splits, counts := r.Summarize().SplitPoints(4)
+	t.Logf("splits:%v counts:%v", splits, counts)
+	for i, split := range splits {
+		if split != -1 || counts[i] != 0 {
+			t.Fatalf("expected empty ranges at the repeated value")
+		}
+	}
+	if counts[3] != n {
+		t.Fatalf("expected everything in the last range: %d", counts[3])
+	}
+
+	if splits, counts := (Summary{}).SplitPoints(4); splits != nil || counts != nil {
+		t.Fatalf("expected nils for empty summary")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	const n = 100000
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = rand.NormFloat64()
+	}
+	r := NewRandom(0.01)
+	r.AddSlice(values)
+	s := r.Summarize()
+
+	bounds := []float64{-3, -2, -1.5, -1, -0.5, 0, 0.25, 0.5, 1, 2, 3}
+	exact := make([]int64, len(bounds)+1)
+	for _, value := range values {
+		exact[sort.SearchFloat64s(bounds, math.Nextafter(value, math.Inf(1)))]++
+	}
+
+	counts := s.Histogram(bounds)
+	t.Logf("exact:%v counts:%v", exact, counts)
+	if len(counts) != len(bounds)+1 {
+		t.Fatalf("bad length: %d", len(counts))
+	}
+	sum := int64(0)
+	for i, count := range counts {
+		if math.Abs(float64(count-exact[i])) > 0.02*n {
+			t.Fatalf("bucket %d: %d != %d", i, count, exact[i])
+		}
+		sum += count
+	}
+	if sum != n {
+		t.Fatalf("counts sum to %d", sum)
+	}
+
+	if counts := (Summary{}).Histogram(bounds); len(counts) != len(bounds)+1 {
+		t.Fatalf("bad length for empty summary: %d", len(counts))
+	}
+}
+
+func TestEquiDepthHistogram(t *testing.T) {
+	const n = 100000
+
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = rand.ExpFloat64()
+	}
+	r := NewRandom(0.01)
+	r.AddSlice(values)
+	s := r.Summarize()
+	sort.Float64s(values)
+
+	for _, buckets := range []int{1, 4, 10, 25} {
+		edges, counts := s.EquiDepthHistogram(buckets)
+		t.Logf("buckets:%d edges:%v counts:%v", buckets, edges, counts)
+		if len(edges) != buckets+1 || len(counts) != buckets {
+			t.Fatalf("bad lengths: %d %d", len(edges), len(counts))
+		}
+		if edges[0] != values[0] || edges[buckets] != values[n-1] {
+			t.Fatalf("expected the extremes as the outer edges")
+		}
+
+		for i, count := range counts {
+			lo := sort.SearchFloat64s(values, edges[i])
+			hi := sort.SearchFloat64s(values, edges[i+1])
+			if i == buckets-1 {
+				hi = n
+			}
+			if math.Abs(float64(count-int64(hi-lo))) > 0.02*n {
+				t.Fatalf("bucket %d: %d != %d", i, count, hi-lo)
+			}
+			if math.Abs(float64(count)-n/float64(buckets)) > 0.02*n {
+				t.Fatalf("bucket %d: %d not about n/buckets", i, count)
+			}
+		}
+	}
+
+	if edges, counts := (Summary{}).EquiDepthHistogram(4); edges != nil || counts != nil {
+		t.Fatalf("expected nils for empty summary")
+	}
+}
+
+//
+// benchmarks
+//
+
+func benchmarkQuantiles(b *testing.B, eps float64, shuffle bool) {
+	r := NewRandom(eps)
+	Seed(r, rand.NormFloat64)
+	s := r.Summarize()
+
+	ptiles := make([]float64, 0)
+	for ptile := 0.0; ptile <= 1.0; ptile += 1.0 / 32 {
+		ptiles = append(ptiles, ptile)
+	}
+	if shuffle {
+		rand.Shuffle(len(ptiles), func(i, j int) {
+			ptiles[i], ptiles[j] = ptiles[j], ptiles[i]
+		})
+	}
+	out := make([]float64, 0, len(ptiles))
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		out = s.Quantiles(ptiles, out)
+	}
+}
+
+func BenchmarkQuantiles_01(b *testing.B) {
+	benchmarkQuantiles(b, 0.01, false)
+}
+
+func BenchmarkQuantiles_0001(b *testing.B) {
+	benchmarkQuantiles(b, 0.0001, false)
+}
+
+func BenchmarkQuantiles_Shuffled_01(b *testing.B) {
+	benchmarkQuantiles(b, 0.01, true)
+}
+
+func BenchmarkQuantiles_Shuffled_0001(b *testing.B) {
+	benchmarkQuantiles(b, 0.0001, true)
+}
+
+// mergedSummaries returns summaries of merges of sketches with different sizes
+// and epsilons, whose buffers can hold more weight than was observed.
+func mergedSummaries(t *testing.T) []Summary {
+	rng := rand.New(rand.NewSource(1))
+	epss := []float64{0.001, 0.01, 0.05, 0.1}
+
+	out := make([]Summary, 0, 100)
+	for seed := 0; seed < 100; seed++ {
+		rs := make([]FinishedRandom, 1+rng.Intn(6))
+		for i := range rs {
+			r := NewRandomWithSeed(epss[rng.Intn(len(epss))], rng.Uint64())
+			for j := rng.Intn(20000); j > 0; j-- {
+				r.Add(rng.Float64())
+			}
+			rs[i] = r.Finish()
+		}
+		f, err := Merge(uint64(seed), rs[0], rs[1:]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, f.Summarize())
+	}
+	return out
+}
+
+func TestSplitPoints_Merged(t *testing.T) {
+	for _, s := range mergedSummaries(t) {
+		for _, k := range []int{1, 2, 8, 100} {
+			_, counts := s.SplitPoints(k)
+			total := int64(0)
+			for _, count := range counts {
+				if count < 0 {
+					t.Fatalf("negative count: %v", counts)
+				}
+				total += count
+			}
+			if len(counts) > 0 && total != s.Count() {
+				t.Fatalf("counts sum to %d, not %d", total, s.Count())
+			}
+		}
+	}
+}
+
+func TestHistogram_Merged(t *testing.T) {
+	for _, s := range mergedSummaries(t) {
+		bounds := []float64{0, 0.1, 0.5, 0.9, 0.99, 0.999, 1}
+		counts := s.Histogram(bounds)
+		total := int64(0)
+		for _, count := range counts {
+			if count < 0 {
+				t.Fatalf("negative count: %v", counts)
+			}
+			total += count
+		}
+		if total != s.Count() {
+			t.Fatalf("counts sum to %d, not %d", total, s.Count())
+		}
+		for _, bound := range bounds {
+			if cdf := s.CDF(bound); cdf < 0 || cdf > 1 {
+				t.Fatalf("cdf of %v is %v", bound, cdf)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import "math"
+
+// Value is the set of types that quantiles can be estimated for. Integer types
+// like time.Duration are kept as is, so values above 2^53 don't lose the
+// precision they would if they were converted to float64.
+type Value interface {
+	~int64 | ~uint64 | ~float64
+}
+
+// valueKind is the underlying kind of a Value type.
+type valueKind byte
+
+const (
+	kindFloat valueKind = iota
+	kindInt
+	kindUint
+)
+
+// kindOf returns the kind of the Value type. it avoids reflect so that it can
+// be folded away in each instantiation.
+func kindOf[T Value]() valueKind {
+	half := 0.5
+	var zero T
+	switch {
+	case T(half) != 0:
+		return kindFloat
+	case zero-1 < 0:
+		return kindInt
+	default:
+		return kindUint
+	}
+}
+
+// extremes returns the lowest and highest values of the type, which are the
+// infinities for floating point types.
+func extremes[T Value]() (lo, hi T) {
+	switch kindOf[T]() {
+	case kindFloat:
+		lo, hi := math.Inf(-1), math.Inf(1)
+		return T(lo), T(hi)
+	case kindInt:
+		lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+		return T(lo), T(hi)
+	default:
+		hi := uint64(math.MaxUint64)
+		return 0, T(hi)
+	}
+}
+
+// missing returns the value answered when there is no answer, which is NaN for
+// floating point types and zero otherwise.
+func missing[T Value]() T {
+	if kindOf[T]() == kindFloat {
+		nan := math.NaN()
+		return T(nan)
+	}
+	return 0
+}
+
+// isInf reports whether the value is an infinity with the given sign, as in
+// math.IsInf. integer values are never infinite.
+func isInf[T Value](value T, sign int) bool {
+	return kindOf[T]() == kindFloat && math.IsInf(float64(value), sign)
+}
+
+// distance returns b - a as a float64, where a <= b, without overflowing for
+// integer types.
+func distance[T Value](a, b T) float64 {
+	if kindOf[T]() == kindFloat {
+		return float64(b) - float64(a)
+	}
+	return float64(uint64(b) - uint64(a))
+}
+
+// valueBits returns the 64 bits that encode the value.
+func valueBits[T Value](value T) uint64 {
+	if kindOf[T]() == kindFloat {
+		return math.Float64bits(float64(value))
+	}
+	return uint64(value)
+}
+
+// valueFromBits returns the value encoded by the 64 bits.
+func valueFromBits[T Value](bits uint64) T {
+	if kindOf[T]() == kindFloat {
+		return T(math.Float64frombits(bits))
+	}
+	return T(bits)
+}
@@ -0,0 +1,76 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestRandomOf_Int64(t *testing.T) {
+	// the values are all distinct as int64s but not as float64s.
+	const base = int64(1) << 60
+	const n = 100000
+
+	r := NewRandomOf[int64](0.01)
+	for _, i := range rand.Perm(n) {
+		r.Add(base + int64(i))
+	}
+	s := r.Summarize()
+
+	if s.Min() != base || s.Max() != base+n-1 {
+		t.Fatalf("bad extremes: %d %d", s.Min(), s.Max())
+	}
+	for ptile := 0.0; ptile <= 1.0; ptile += 0.01 {
+		got := s.Query(ptile) - base
+		exp := int64(ptile * (n - 1))
+		if math.Abs(float64(got-exp)) > 0.01*n {
+			t.Fatalf("%0.2f: %d != %d", ptile, got, exp)
+		}
+		if cdf := s.CDF(base + exp); math.Abs(cdf-ptile) > 0.01 {
+			t.Fatalf("%0.2f: cdf %v", ptile, cdf)
+		}
+	}
+}
+
+func TestRandomOf_Duration(t *testing.T) {
+	r := NewRandomOf[time.Duration](0.01)
+	for i := 0; i < 100000; i++ {
+		r.Add(time.Duration(rand.Int63n(int64(time.Second))))
+	}
+	s := r.Summarize()
+
+	median := s.Query(0.5)
+	t.Logf("median:%v", median)
+	if median < 490*time.Millisecond || median > 510*time.Millisecond {
+		t.Fatalf("bad median: %v", median)
+	}
+
+	if empty := NewRandomOf[time.Duration](0.01).Summarize(); empty.Query(0.5) != 0 {
+		t.Fatalf("expected zero from empty summary")
+	}
+}
+
+func TestLerp_Integers(t *testing.T) {
+	if got := lerp[int64](math.MinInt64, math.MaxInt64, 0.5); got != 0 {
+		t.Fatalf("bad int64 midpoint: %d", got)
+	}
+	if got := lerp[int64](math.MinInt64, math.MaxInt64, 1); got != math.MaxInt64 {
+		t.Fatalf("bad int64 end: %d", got)
+	}
+	if got := lerp[uint64](0, math.MaxUint64, 0.5); got != 1<<63 {
+		t.Fatalf("bad uint64 midpoint: %d", got)
+	}
+	if got := lerp[uint64](10, 13, 0.5); got != 12 {
+		t.Fatalf("expected rounding: %d", got)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	if kindOf[float64]() != kindFloat || kindOf[int64]() != kindInt ||
+		kindOf[uint64]() != kindUint || kindOf[time.Duration]() != kindInt {
+		t.Fatalf("bad kinds")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// WindowedRandom is a random quantile estimator over a sliding window of time.
+// The window is split into intervals, each with their own Random, and the
+// Random for an interval that has left the window is reset and reused for the
+// next one. Like Random, it is not safe to use from many goroutines at once.
+type WindowedRandom struct {
+	eps      float64
+	interval int64 // nanoseconds
+	now      func() time.Time
+	slots    []windowSlot
+	pcg      pcg // used to seed the intervals and merges
+}
+
+// windowSlot is the Random for an interval.
+type windowSlot struct {
+	r     *Random
+	epoch int64 // the index of the interval the Random holds values for
+}
+
+// NewWindowedRandom calls NewWindowedRandomWithClock with time.Now and a random
+// seed from math/rand.
+func NewWindowedRandom(eps float64, window time.Duration, intervals int) (
+	w *WindowedRandom) {
+
+	return NewWindowedRandomWithClock(eps, window, intervals, time.Now,
+		uint64(rand.Int63()))
+}
+
+// NewWindowedRandomWithClock constructs a WindowedRandom with the given
+// epsilon tolerance over the given window, split into the given number of
+// intervals. The window slides forward an interval at a time, as measured by
+// the now function. The seed parameter lets one choose what seed to use for
+// the collection of the stream. It panics if the epsilon is not within (0, 1)
+// or is too small to allocate buffers for.
+func NewWindowedRandomWithClock(eps float64, window time.Duration,
+	intervals int, now func() time.Time, seed uint64) (w *WindowedRandom) {
+
+	mustValidEps(eps)
+	if intervals <= 0 {
+		intervals = 1
+	}
+	interval := int64(window) / int64(intervals)
+	if interval <= 0 {
+		interval = 1
+	}
+
+	w = &WindowedRandom{
+		eps:      eps,
+		interval: interval,
+		now:      now,
+		slots:    make([]windowSlot, intervals),
+		pcg:      newPCG(seed, 3),
+	}
+	for i := range w.slots {
+		w.slots[i] = windowSlot{
+			r:     NewRandomWithSeed(eps, w.pcg.Uint64()),
+			epoch: math.MinInt64,
+		}
+	}
+	return w
+}
+
+// epoch returns the index of the interval that is current.
+func (w *WindowedRandom) epoch() int64 {
+	return epochOf(w.now(), w.interval)
+}
+
+// epochOf returns the index of the interval, of the given length in
+// nanoseconds, that the time falls in, rounding down before the unix epoch.
+func epochOf(now time.Time, interval int64) int64 {
+	nanos := now.UnixNano()
+	epoch := nanos / interval
+	if nanos%interval < 0 {
+		epoch--
+	}
+	return epoch
+}
+
+// Add puts the value in the quantile estimator for the current interval.
+func (w *WindowedRandom) Add(value float64) {
+	epoch := w.epoch()
+
+	idx := epoch % int64(len(w.slots))
+	if idx < 0 {
+		idx += int64(len(w.slots))
+	}
+
+	// if the slot holds an interval that has left the window, reuse it.
+	slot := &w.slots[idx]
+	if slot.epoch != epoch {
+		slot.r.Reset(w.pcg.Uint64())
+		slot.epoch = epoch
+	}
+	slot.r.Add(value)
+}
+
+// Snapshot returns a FinishedRandom that merges every interval still in the
+// window. It is safe to continue calling Add after Snapshot.
+func (w *WindowedRandom) Snapshot() FinishedRandom {
+	epoch := w.epoch()
+
+	rs := make([]FinishedRandom, 0, len(w.slots))
+	for _, slot := range w.slots {
+		if slot.epoch <= epoch && slot.epoch > epoch-int64(len(w.slots)) {
+			rs = append(rs, slot.r.Snapshot())
+		}
+	}
+
+	if len(rs) == 0 {
+		return FinishedRandom{
+			E:   w.eps,
+			Min: math.Inf(1),
+			Max: math.Inf(-1),
+		}
+	}
+
+	return mergeSameEps(w.pcg.Uint64(), rs[0], rs[1:]...)
+}
+
+// Summarize is a helper that returns a Summary for a WindowedRandom.
+func (w *WindowedRandom) Summarize() Summary {
+	return w.Snapshot().Summarize()
+}
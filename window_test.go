@@ -0,0 +1,84 @@
+// Copyright (C) 2018. See AUTHORS.
+
+package random
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestWindowed(t *testing.T) {
+	now := time.Unix(1000, 0)
+	w := NewWindowedRandomWithClock(0.01, 5*time.Minute, 5,
+		func() time.Time { return now }, 1)
+	rng := rand.New(rand.NewSource(2))
+
+	if !w.Summarize().Empty() {
+		t.Fatalf("expected empty summary")
+	}
+
+	add := func(count int, lo float64) {
+		for i := 0; i < count; i++ {
+			w.Add(lo + rng.Float64())
+		}
+	}
+	check := func(n int64, min, max float64) {
+		f := w.Snapshot()
+		s := f.Summarize()
+		t.Logf("now:%v n:%d min:%v max:%v", now.Unix(), f.N, s.Min(), s.Max())
+		if f.N != n {
+			t.Fatalf("expected %d values: %d", n, f.N)
+		}
+		if n > 0 && (s.Min() < min || s.Max() > max) {
+			t.Fatalf("expected values in [%v, %v]", min, max)
+		}
+	}
+
+	add(10000, 0)
+	check(10000, 0, 1)
+
+	now = now.Add(3 * time.Minute)
+	add(20000, 10)
+	check(30000, 0, 11)
+	if median := w.Summarize().Query(0.5); median < 10 {
+		t.Fatalf("expected median from the later values: %v", median)
+	}
+
+	// the first interval leaves the window.
+	now = now.Add(2 * time.Minute)
+	check(20000, 10, 11)
+
+	// the slot for the first interval gets reused.
+	add(5000, 20)
+	check(25000, 10, 21)
+
+	// everything leaves the window.
+	now = now.Add(time.Hour)
+	check(0, 0, 0)
+	if !w.Summarize().Empty() {
+		t.Fatalf("expected empty summary")
+	}
+}
+
+func TestWindowed_BeforeEpoch(t *testing.T) {
+	now := time.Unix(-10, 0)
+	w := NewWindowedRandomWithClock(0.01, time.Minute, 4,
+		func() time.Time { return now }, 1)
+	rng := rand.New(rand.NewSource(2))
+
+	// the intervals before and after the unix epoch are all distinct.
+	for i := 0; i < 1000; i++ {
+		w.Add(rng.Float64())
+		now = now.Add(30 * time.Millisecond)
+	}
+	if n := w.Snapshot().N; n != 1000 {
+		t.Fatalf("expected all of the values in the window: %d", n)
+	}
+}
+
+func TestWindowed_BadEpsilon(t *testing.T) {
+	for _, eps := range []float64{0, 1, 2, 1e-300} {
+		expectPanic(t, func() { NewWindowedRandom(eps, time.Minute, 4) })
+	}
+}